@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/SotaEndo0214/pbbotfunc/pkg/pokemonsleep"
+	"go.uber.org/zap"
+)
+
+const analyzeUsage = `usage:
+  analyze [-category salad|curry|dessert] [-pot N] [-level N] [-format text|json] [-lang ja|en] [-replay DIR | -record DIR] [-overlay DIR] [-eps EPS] [-icons DIR] [-save-icons DIR] IMAGE...
+    画像の食材を検出して作れるレシピを表示する（複数の画像は1つの在庫にまとめる）
+    -replayを指定すると記録済みのOCR結果を使い、Vision APIを呼ばずにオフラインで実行する
+      （IMAGEには画像のほか、DIR以下のFixture名も指定できる。例: analyze -replay data/fixtures/synthetic bag_all_foods）
+    -iconsを指定すると食材名が読めなかったマスをアイコンの見本（<label>.png）との照合で補う
+    -save-iconsを指定すると食材名が読めたマスのアイコンを見本として書き出す
+    -overlayを指定するとOCRの枠と食材の対応を描いた画像を書き出す（-epsと合わせてクラスタリングの調整に使う）`
+
+var categoryNames = map[string]string{
+	"salad":   "サラダ",
+	"curry":   "カレー",
+	"dessert": "デザート",
+}
+
+func runAnalyze(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprintln(fs.Output(), analyzeUsage) }
+	category := fs.String("category", "", "recipe category (salad, curry, dessert; default: all)")
+	pot := fs.Int("pot", 0, "pot capacity (0: ignore)")
+	level := fs.Int("level", 0, "recipe level")
+	format := fs.String("format", "text", "output format (text, json)")
+	lang := fs.String("lang", pokemonsleep.DefaultLocale, "language of names and messages (ja, en)")
+	replayDir := fs.String("replay", "", "read OCR results recorded in this directory instead of calling Vision API")
+	recordDir := fs.String("record", "", "record Vision API results to this directory")
+	overlayDir := fs.String("overlay", "", "write debug overlay images to this directory")
+	eps := fs.Float64("eps", 0, "clustering distance in units of text height (0: default)")
+	iconsDir := fs.String("icons", "", "directory of reference icons named by foods.json label")
+	saveIconsDir := fs.String("save-icons", "", "write icons of detected foods to this directory as references")
+	foodsPath := fs.String("foods", "data/foods.json", "foods.json path")
+	cooksPath := fs.String("cooks", "data/cooks.json", "cooks.json path")
+
+	// 画像のあとにフラグを書いても受け付ける
+	paths := []string{}
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		paths = append(paths, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(paths) == 0 {
+		return errors.New(analyzeUsage)
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+	if !pokemonsleep.SupportedLocale(*lang) {
+		return fmt.Errorf("unknown language: %s", *lang)
+	}
+
+	var text []string
+	if *category != "" {
+		name, ok := categoryNames[*category]
+		if !ok {
+			name = *category
+		}
+		text = append(text, name)
+	}
+	if *pot > 0 {
+		text = append(text, "鍋"+strconv.Itoa(*pot))
+	}
+	if *level > 0 {
+		text = append(text, "lv"+strconv.Itoa(*level))
+	}
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		return fmt.Errorf("init logger failed: %w", err)
+	}
+	defer logger.Sync()
+
+	var detector pokemonsleep.TextDetector
+	if *replayDir != "" {
+		detector = pokemonsleep.NewReplayDetector(*replayDir)
+	} else {
+		vision, err := pokemonsleep.NewVisionDetector(ctx)
+		if err != nil {
+			return err
+		}
+		detector = vision
+		if *recordDir != "" {
+			detector = pokemonsleep.NewRecordingDetector(vision, *recordDir)
+		}
+	}
+	client, err := pokemonsleep.NewClientWithDetector("", detector, *foodsPath, *cooksPath, logger)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	client.ClusterEps = *eps
+	if *iconsDir != "" {
+		client.Icons, err = pokemonsleep.LoadIconMatcher(*iconsDir, client.Foods)
+		if err != nil {
+			return err
+		}
+	}
+
+	imgs := []*pokemonsleep.Image{}
+	for _, path := range paths {
+		img, err := loadImage(path, *replayDir, logger)
+		if err != nil {
+			return err
+		}
+		imgs = append(imgs, img)
+	}
+
+	report, err := client.GetResultFromImages(ctx, "", strings.Join(text, " "), *lang, imgs...)
+	if err != nil {
+		return err
+	}
+
+	if *saveIconsDir != "" {
+		for _, dres := range report.Detections {
+			if err := dres.SaveIcons(*saveIconsDir); err != nil {
+				return err
+			}
+		}
+	}
+	if *overlayDir != "" {
+		if err := writeOverlays(*overlayDir, paths, report.Detections); err != nil {
+			return err
+		}
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "    ")
+		return enc.Encode(report)
+	}
+	fmt.Println(strings.Join(report.Texts(), "\n"))
+	return nil
+}
+
+// 画像を読み込む
+// -replayのときは画像ファイルがなければFixture名とみなし、画像があればファイル名でも記録を探せるよう名前をつける
+func loadImage(path, replayDir string, logger *zap.Logger) (*pokemonsleep.Image, error) {
+	if replayDir != "" {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			fixture, err := pokemonsleep.LoadFixture(replayDir, path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			return fixture.Image(logger), nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read image failed: %w", err)
+	}
+	img, err := pokemonsleep.DecodeImage(data, logger)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if replayDir != "" {
+		img.Bytes = pokemonsleep.NewNamedReader(path, img.Bytes)
+	}
+	return img, nil
+}
+
+// 画像ごとにデバッグ用の画像を書き出し、番号と食材の対応を標準エラーに出す
+func writeOverlays(dir string, paths []string, dresults []*pokemonsleep.DetectResult) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create directory failed: %w", err)
+	}
+	for i, dres := range dresults {
+		data, err := dres.OverlayPNG()
+		if err != nil {
+			return fmt.Errorf("%s: %w", paths[i], err)
+		}
+		name := strings.TrimSuffix(filepath.Base(paths[i]), filepath.Ext(paths[i])) + ".overlay.png"
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return fmt.Errorf("write file failed: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "%s:\n%s", path, dres.OverlayLegend())
+	}
+	return nil
+}
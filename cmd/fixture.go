@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+
+	"github.com/SotaEndo0214/pbbotfunc/pkg/pokemonsleep"
+	"go.uber.org/zap"
+)
+
+const fixtureUsage = `usage:
+  fixture record [-dir data/fixtures] [-name NAME] IMAGE   Vision APIでOCRした結果をFixtureとして記録する
+    スクロール途中・下端で切れた・行の詰まった画面など、実際のスクリーンショットを記録する
+    手で作ったOCR結果は data/fixtures/synthetic に置き、"synthetic": true とする
+    記録したFixtureの検証は go test ./pkg/pokemonsleep -run TestFixtures で行う`
+
+func runFixture(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(fixtureUsage)
+	}
+
+	fs := flag.NewFlagSet("fixture "+args[0], flag.ExitOnError)
+	dir := fs.String("dir", "data/fixtures", "fixture directory")
+	name := fs.String("name", "", "fixture name (record only, default: image file name)")
+	foodsPath := fs.String("foods", "data/foods.json", "foods.json path")
+	cooksPath := fs.String("cooks", "data/cooks.json", "cooks.json path")
+	fs.Parse(args[1:])
+
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		return fmt.Errorf("init logger failed: %w", err)
+	}
+	defer logger.Sync()
+
+	switch args[0] {
+	case "record":
+		if fs.NArg() != 1 {
+			return errors.New(fixtureUsage)
+		}
+		detector, err := pokemonsleep.NewVisionDetector(ctx)
+		if err != nil {
+			return err
+		}
+		client, err := pokemonsleep.NewClientWithDetector("", detector, *foodsPath, *cooksPath, logger)
+		if err != nil {
+			return err
+		}
+		defer client.Close()
+		return recordFixture(ctx, client, *dir, *name, fs.Arg(0))
+	default:
+		return errors.New(fixtureUsage)
+	}
+}
+
+func recordFixture(ctx context.Context, client *pokemonsleep.Client, dir, name, imagePath string) error {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return fmt.Errorf("read image failed: %w", err)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("decode image config failed: %w", err)
+	}
+	if name == "" {
+		name = pokemonsleep.FixtureName(imagePath)
+	}
+
+	boxes, err := client.Detector.DetectTexts(ctx, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	fixture := &pokemonsleep.Fixture{
+		Name:   name,
+		Width:  config.Width,
+		Height: config.Height,
+		Boxes:  boxes,
+	}
+	// 現在の検出結果を期待値の雛形とする（手で確認・修正すること）
+	fixture.Expected = fixture.Detect(client.FoodMatcher, client.Logger).DetectedFoods
+	if err := fixture.Save(dir); err != nil {
+		return err
+	}
+
+	annotationsPath, expectedPath := pokemonsleep.FixturePaths(dir, name)
+	fmt.Printf("recorded %s and %s\nreview the expected foods before committing.\n", annotationsPath, expectedPath)
+	return nil
+}
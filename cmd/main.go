@@ -2,14 +2,55 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/GoogleCloudPlatform/functions-framework-go/funcframework"
 	psbotfunc "github.com/SotaEndo0214/pbbotfunc"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "fixture":
+			if err := runFixture(context.Background(), os.Args[2:]); err != nil {
+				log.Fatalf("fixture: %v\n", err)
+			}
+			return
+		case "analyze":
+			if err := runAnalyze(context.Background(), os.Args[2:]); err != nil {
+				log.Fatalf("analyze: %v\n", err)
+			}
+			return
+		case "socket":
+			// Events APIの代わりにSocket Modeで受信する
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			if err := psbotfunc.RunSocketMode(ctx, os.Getenv("SLACK_APP_TOKEN")); err != nil && !errors.Is(err, context.Canceled) {
+				log.Fatalf("socket mode: %v\n", err)
+			}
+			return
+		}
+	}
+
+	// funcframework.Startは戻らないので、終了シグナルを受けたらここでAppを閉じて終了する
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		if err := psbotfunc.Shutdown(); err != nil {
+			log.Printf("shutdown: %v\n", err)
+		}
+		os.Exit(0)
+	}()
+
 	funcframework.RegisterHTTPFunctionContext(context.Background(), "/", psbotfunc.PokemonSleepFoods)
+	// デプロイ時は別の関数になるので、ローカルでは/api以下に載せる
+	funcframework.RegisterHTTPFunctionContext(context.Background(), "/api/", http.StripPrefix("/api", http.HandlerFunc(psbotfunc.PokemonSleepAPI)).ServeHTTP)
 	port := "8080"
 	if err := funcframework.Start(port); err != nil {
 		log.Fatalf("funcframework.Start: %v\n", err)
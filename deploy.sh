@@ -15,3 +15,35 @@ gcloud functions deploy pokemonsleepbot \
     --set-env-vars=SLACK_SIGNING_SECRETS=$PUBLIC_SLACK_SIGNING_SECRETS \
     --set-env-vars=POKEMONSLEEP_FOODS_JSON_PATH=/workspace/serverless_function_source_code/data/foods.json \
     --set-env-vars=POKEMONSLEEP_COOKS_JSON_PATH=/workspace/serverless_function_source_code/data/cooks.json \
+
+# 在庫（FileInventoryStore）はPOKEMONSLEEP_INVENTORY_DIR以下にユーザーごとのファイルとして保存する
+# 既定の/tmpはメモリ上でインスタンスごとに別なので、Cloud Storageのバケットをマウントして全インスタンスで同じディレクトリを使う
+gcloud run services update pokemonsleepbot \
+    --region asia-northeast2 \
+    --execution-environment=gen2 \
+    --add-volume=name=inventory,type=cloud-storage,bucket=$POKEMONSLEEP_INVENTORY_BUCKET \
+    --add-volume-mount=volume=inventory,mount-path=/mnt/inventory \
+    --update-env-vars=POKEMONSLEEP_INVENTORY_DIR=/mnt/inventory
+
+# Slackには3秒以内に応答してから、OCRと返信は応答後のgoroutineで行う
+# 既定では応答後にCPUが割り当てられず返信まで進まないことがあるので、常にCPUを割り当てる
+# 再送イベントの重複排除（MemorySeenEventStore）はインスタンスごとなので、別のインスタンスに届いた再送は重複して処理されうる
+gcloud run services update pokemonsleepbot \
+    --region asia-northeast2 \
+    --no-cpu-throttling
+
+gcloud functions deploy pokemonsleepapi \
+    --gen2 \
+    --runtime=go121 \
+    --region asia-northeast2 \
+    --source . \
+    --entry-point=PokemonSleepAPI \
+    --trigger-http \
+    --allow-unauthenticated \
+    --max-instances=2 \
+    --cpu=1 \
+    --memory=1Gi \
+    --set-env-vars=SLACK_AUTH_TOKEN=$PUBLIC_SLACK_AUTH_TOKEN \
+    --set-env-vars="^@^POKEMONSLEEP_API_KEYS=$POKEMONSLEEP_API_KEYS" \
+    --set-env-vars=POKEMONSLEEP_FOODS_JSON_PATH=/workspace/serverless_function_source_code/data/foods.json \
+    --set-env-vars=POKEMONSLEEP_COOKS_JSON_PATH=/workspace/serverless_function_source_code/data/cooks.json
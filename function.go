@@ -2,75 +2,348 @@ package psbotfunc
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 
 	"github.com/SotaEndo0214/pbbotfunc/pkg/pokemonsleep"
 	"github.com/SotaEndo0214/pbbotfunc/pkg/slackbot"
-	"github.com/slack-go/slack"
+	"github.com/SotaEndo0214/pbbotfunc/pkg/webapi"
 	"github.com/slack-go/slack/slackevents"
 	"go.uber.org/zap"
 )
 
-func PokemonSleepFoods(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+// プロセス全体で使い回すbotの状態
+// リクエストごとにloggerやVision clientを作り直さないよう、初回のリクエストで一度だけ構築する
+type App struct {
+	Logger *zap.Logger
+	Client *pokemonsleep.Client
+	Bot    *slackbot.SlackBot
+	API    http.Handler
+}
+
+var (
+	appMu sync.Mutex
+	app   *App
+)
+
+// 構築済みのAppを返す。未構築であればここで構築する
+// 構築に失敗した場合は保持せず、次の呼び出しで再試行する
+func GetApp(ctx context.Context) (*App, error) {
+	appMu.Lock()
+	defer appMu.Unlock()
+
+	if app != nil {
+		return app, nil
+	}
+	a, err := NewApp(ctx)
+	if err != nil {
+		return nil, err
+	}
+	app = a
+	return app, nil
+}
+
+// 構築済みのAppを閉じる。次のGetAppでは再構築される
+func Shutdown() error {
+	appMu.Lock()
+	defer appMu.Unlock()
+
+	if app == nil {
+		return nil
+	}
+	err := app.Close()
+	app = nil
+	return err
+}
+
+func NewApp(ctx context.Context) (*App, error) {
 	token := os.Getenv("SLACK_AUTH_TOKEN")
 	secrets := os.Getenv("SLACK_SIGNING_SECRETS")
 	foodConfPath := os.Getenv("POKEMONSLEEP_FOODS_JSON_PATH")
 	cookConfPath := os.Getenv("POKEMONSLEEP_COOKS_JSON_PATH")
+	replayDir := os.Getenv("POKEMONSLEEP_OCR_REPLAY_DIR")
+	inventoryDir := os.Getenv("POKEMONSLEEP_INVENTORY_DIR")
+	iconsDir := os.Getenv("POKEMONSLEEP_ICONS_DIR")
 
 	logger, err := zap.NewProduction()
 	if err != nil {
-		logger.Error("failed init logger.", zap.Error(err))
+		return nil, fmt.Errorf("init logger failed: %w", err)
+	}
+	if inventoryDir == "" {
+		// Cloud Functionsの/tmpはメモリ上にあり、インスタンスごとに別で、インスタンスが止まると消える
+		// 在庫を残すにはdeploy.shのように永続化したストレージ上のディレクトリを指定する
+		inventoryDir = filepath.Join(os.TempDir(), "pokemonsleep-inventory")
+		logger.Warn("POKEMONSLEEP_INVENTORY_DIR is not set. inventories are kept only in this instance.", zap.String("dir", inventoryDir))
+	}
+
+	var psclient *pokemonsleep.Client
+	if replayDir != "" {
+		psclient, err = pokemonsleep.NewClientWithDetector(token, pokemonsleep.NewReplayDetector(replayDir), foodConfPath, cookConfPath, logger)
+	} else {
+		psclient, err = pokemonsleep.NewClientFromLocal(ctx, token, foodConfPath, cookConfPath, logger)
+	}
+	if err != nil {
+		logger.Sync()
+		return nil, fmt.Errorf("init PokemonSleep Client failed: %w", err)
+	}
+	psclient.Inventories = pokemonsleep.NewFileInventoryStore(inventoryDir)
+	if iconsDir != "" {
+		psclient.Icons, err = pokemonsleep.LoadIconMatcher(iconsDir, psclient.Foods)
+		if err != nil {
+			psclient.Close()
+			logger.Sync()
+			return nil, fmt.Errorf("load icons failed: %w", err)
+		}
+	}
+
+	ret := &App{
+		Logger: logger,
+		Client: psclient,
+	}
+	ret.Bot = slackbot.NewSlackBot(logger, token, secrets, ret.HandleEvent)
+	ret.Bot.Renderer = slackbot.NewRenderer(os.Getenv("POKEMONSLEEP_RENDERER"))
+	ret.RegisterCommands(ret.Bot.Commands)
+	ret.API = webapi.NewServer(logger, psclient, webapi.ParseAPIKeys(os.Getenv("POKEMONSLEEP_API_KEYS")))
+	return ret, nil
+}
+
+// 処理中のイベントを待ってから、Vision clientなどを閉じる
+func (a *App) Close() error {
+	a.Bot.Wait()
+	err := a.Client.Close()
+	a.Logger.Sync()
+	if err != nil {
+		return fmt.Errorf("close PokemonSleep Client failed: %w", err)
+	}
+	return nil
+}
+
+func PokemonSleepFoods(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	a, err := GetApp(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "failed init app: %v\n", err)
 		return
 	}
-	defer logger.Sync()
 
-	bot := slackbot.NewSlackBot(logger, token, secrets, func(s *slackbot.SlackBot, ctx context.Context, event slackevents.EventsAPIEvent) error {
-		s.Logger.Info("callback")
-		innerEvent := event.InnerEvent
-		switch ev := innerEvent.Data.(type) {
-		case *slackevents.AppMentionEvent:
-			var message slackbot.SlackMessage
-			err := slackbot.ConverToMessage(event, &message)
-			if err != nil {
-				return fmt.Errorf("handle callback failed: %w", err)
-			}
+	err = a.Bot.HandleRequest(ctx, w, r)
+	if err != nil {
+		a.Logger.Error("failed handle request.", zap.Error(err))
+		return
+	}
+}
 
-			if len(message.Files) == 0 {
-				_, _, err = s.Api.PostMessage(ev.Channel, slack.MsgOptionText("画像を添付してください", false))
-				if err != nil {
-					return fmt.Errorf("handle callback failed: %w", err)
-				}
-				return nil
+// Slackを介さないJSON API（APIキーで認証する）
+func PokemonSleepAPI(w http.ResponseWriter, r *http.Request) {
+	a, err := GetApp(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(os.Stderr, "failed init app: %v\n", err)
+		return
+	}
+	a.API.ServeHTTP(w, r)
+}
+
+// Socket Modeで起動する（公開URLなしでローカル実行する用）
+func RunSocketMode(ctx context.Context, appToken string) error {
+	a, err := GetApp(ctx)
+	if err != nil {
+		return fmt.Errorf("init app failed: %w", err)
+	}
+	defer Shutdown()
+
+	return slackbot.NewSocketModeRunner(a.Bot, appToken).Run(ctx)
+}
+
+func (a *App) HandleEvent(s *slackbot.SlackBot, ctx context.Context, event slackevents.EventsAPIEvent) error {
+	s.Logger.Info("callback")
+	innerEvent := event.InnerEvent
+	switch ev := innerEvent.Data.(type) {
+	case *slackevents.AppMentionEvent:
+		var message slackbot.SlackMessage
+		err := slackbot.ConverToMessage(event, &message)
+		if err != nil {
+			return fmt.Errorf("handle callback failed: %w", err)
+		}
+
+		// 本文で言語が指定されていなければ、ユーザーのSlackのロケールで返信する
+		locale := pokemonsleep.ResolveLocale(message.Text, s.UserLocale(ctx, message.User))
+
+		// 画像でない添付ファイル（PDFなど）はOCRに渡さず、読み取らなかったことを伝える
+		files, skipped := imageFiles(&message)
+		if len(skipped) > 0 {
+			notes := []string{}
+			for _, name := range skipped {
+				notes = append(notes, pokemonsleep.Msg(locale, "「%s」は画像ではないので読み取りませんでした", name))
+			}
+			if err := s.PostText(ev.Channel, message.Ts, strings.Join(notes, "\n")); err != nil {
+				return err
 			}
+		}
 
-			psclient, err := pokemonsleep.NewClientFromLocal(ctx, s.Token, foodConfPath, cookConfPath, s.Logger)
+		// 画像がなく在庫の修正（例: "リンゴ +3"）だけが含まれていれば、保存済みの在庫を直して評価し直す
+		if len(files) == 0 && pokemonsleep.IsInventoryEdit(message.Text) {
+			report, notes, err := a.Client.EditInventory(ctx, message.User, message.Text, locale)
 			if err != nil {
-				return fmt.Errorf("init PokemonSleep Client failed: %w", err)
+				return fmt.Errorf("failed to edit inventory: %w", err)
 			}
-			result, err := psclient.GetResultText(ctx, message.Text, message.Files[0].Filetype, message.Files[0].URLPrivateDownload, message.Files[0].OriginalW, message.Files[0].OriginalH)
+			if report != nil {
+				return s.PostReport(ev.Channel, message.Ts, report)
+			}
+			if len(notes) > 0 {
+				return s.PostText(ev.Channel, message.Ts, strings.Join(notes, "\n"))
+			}
+		}
+
+		// "在庫"（"inventory"）だけなら保存済みの在庫を返す
+		if pokemonsleep.HasKeyword(message.Text, "在庫", "inventory") && len(files) == 0 {
+			text, err := a.Client.GetInventoryText(ctx, message.User, locale)
 			if err != nil {
-				return fmt.Errorf("failed to get result text: %w", err)
+				return fmt.Errorf("failed to get inventory text: %w", err)
 			}
+			return s.PostText(ev.Channel, message.Ts, text)
+		}
 
-			for _, text := range result {
-				_, _, err = s.Api.PostMessage(ev.Channel, slack.MsgOptionText(text, false), slack.MsgOptionTS(message.Ts))
+		// "献立"（"plan"）が含まれていれば1週間の献立を立てる（画像がなければ保存済みの在庫を使う）
+		if pokemonsleep.HasKeyword(message.Text, "献立", "plan") {
+			var plan string
+			if len(files) == 0 {
+				inventory, err := a.Client.LoadInventory(ctx, message.User)
+				if err != nil {
+					return fmt.Errorf("failed to load inventory: %w", err)
+				}
+				if inventory == nil {
+					return s.PostText(ev.Channel, "", pokemonsleep.Msg(locale, "画像を添付してください"))
+				}
+				plan = a.Client.GetPlanTextFromFoods(message.Text, locale, inventory.Foods)
+			} else {
+				plan, err = a.Client.GetPlanText(ctx, message.User, message.Text, locale, files)
 				if err != nil {
-					return fmt.Errorf("handle callback failed: %w", err)
+					return fmt.Errorf("failed to get plan text: %w", err)
 				}
 			}
-		default:
-			return errors.New("unknown event")
+			return s.PostText(ev.Channel, message.Ts, plan)
 		}
-		return nil
+
+		if len(files) == 0 {
+			return s.PostText(ev.Channel, "", pokemonsleep.Msg(locale, "画像を添付してください"))
+		}
+
+		report, err := a.Client.GetResult(ctx, message.User, message.Text, locale, files)
+		if err != nil {
+			return fmt.Errorf("failed to get result: %w", err)
+		}
+		if err := s.PostReport(ev.Channel, message.Ts, report); err != nil {
+			return err
+		}
+
+		// "デバッグ"が含まれていれば、OCRの枠と食材の対応を描いた画像をスレッドに添える
+		if pokemonsleep.HasKeyword(message.Text, "デバッグ", "debug") {
+			for i, dres := range report.Detections {
+				data, err := dres.OverlayPNG()
+				if err != nil {
+					return fmt.Errorf("failed to draw overlay: %w", err)
+				}
+				if err := s.UploadFile(ev.Channel, message.Ts, fmt.Sprintf("overlay-%d.png", i+1), data, dres.OverlayLegend()); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		// 購読していても処理しないイベントはエラーにせず読み捨てる
+		s.Logger.Info("ignored event.", zap.String("type", innerEvent.Type))
+	}
+	return nil
+}
+
+// スラッシュコマンド（/pokesleep）のサブコマンドを登録する
+// 画像を添付できないので、どれもメンションで保存した在庫を使う
+func (a *App) RegisterCommands(commands *slackbot.CommandRegistry) {
+	commands.Register(&slackbot.Command{
+		Name:        "recipes",
+		Usage:       "recipes [salad|curry|dessert] [pot N] [lv N]",
+		Description: "保存済みの在庫で作れるレシピを表示する",
+		Handler:     a.HandleRecipesCommand,
 	})
+	commands.Register(&slackbot.Command{
+		Name:        "inventory",
+		Usage:       "inventory [apple +3 tomato=12 ...]",
+		Description: "保存済みの在庫を表示する（食材名と数を添えると在庫を修正する）",
+		Handler:     a.HandleInventoryCommand,
+	})
+	commands.Register(&slackbot.Command{
+		Name:        "plan",
+		Usage:       "plan salad|curry|dessert [pot N] [lv N] [daily apple 10 ...]",
+		Description: "保存済みの在庫から1週間の献立を立てる",
+		Handler:     a.HandlePlanCommand,
+	})
+}
 
-	err = bot.HandleRequest(ctx, w, r)
+func (a *App) HandleRecipesCommand(s *slackbot.SlackBot, ctx context.Context, req *slackbot.CommandRequest) error {
+	locale := pokemonsleep.ResolveLocale(req.Args, s.UserLocale(ctx, req.UserID))
+	report, err := a.Client.GetResultFromInventory(ctx, req.UserID, req.Args, locale)
 	if err != nil {
-		logger.Error("failed handle request.", zap.Error(err))
-		return
+		return fmt.Errorf("failed to get result: %w", err)
+	}
+	if report == nil {
+		return s.RespondText(req, pokemonsleep.Msg(locale, "在庫が保存されていません。食材の画像を添付してください"))
+	}
+	return s.RespondReport(req, report)
+}
+
+func (a *App) HandleInventoryCommand(s *slackbot.SlackBot, ctx context.Context, req *slackbot.CommandRequest) error {
+	locale := pokemonsleep.ResolveLocale(req.Args, s.UserLocale(ctx, req.UserID))
+	report, notes, err := a.Client.EditInventory(ctx, req.UserID, req.Args, locale)
+	if err != nil {
+		return fmt.Errorf("failed to edit inventory: %w", err)
+	}
+	if report != nil {
+		return s.RespondReport(req, report)
+	}
+	text, err := a.Client.GetInventoryText(ctx, req.UserID, locale)
+	if err != nil {
+		return fmt.Errorf("failed to get inventory text: %w", err)
+	}
+	if len(notes) > 0 {
+		text = strings.Join(notes, "\n") + "\n\n" + text
+	}
+	return s.RespondText(req, text)
+}
+
+func (a *App) HandlePlanCommand(s *slackbot.SlackBot, ctx context.Context, req *slackbot.CommandRequest) error {
+	locale := pokemonsleep.ResolveLocale(req.Args, s.UserLocale(ctx, req.UserID))
+	inventory, err := a.Client.LoadInventory(ctx, req.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load inventory: %w", err)
+	}
+	if inventory == nil {
+		return s.RespondText(req, pokemonsleep.Msg(locale, "在庫が保存されていません。食材の画像を添付してください"))
+	}
+	return s.RespondText(req, a.Client.GetPlanTextFromFoods(req.Args, locale, inventory.Foods))
+}
+
+// 添付されたファイルのうち画像をOCRの対象とする
+// 画像でないファイルの名前は2つ目の戻り値で返す
+func imageFiles(message *slackbot.SlackMessage) ([]pokemonsleep.ImageFile, []string) {
+	files := []pokemonsleep.ImageFile{}
+	skipped := []string{}
+	for _, file := range message.Files {
+		if !strings.HasPrefix(file.Mimetype, "image/") {
+			skipped = append(skipped, file.Name)
+			continue
+		}
+		files = append(files, pokemonsleep.ImageFile{
+			Filetype: file.Filetype,
+			URL:      file.URLPrivateDownload,
+			Width:    file.OriginalW,
+			Height:   file.OriginalH,
+		})
 	}
+	return files, skipped
 }
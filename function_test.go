@@ -0,0 +1,35 @@
+package psbotfunc
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/SotaEndo0214/pbbotfunc/pkg/slackbot"
+)
+
+// 画像でない添付ファイルはOCRの対象にしない
+func TestImageFiles(t *testing.T) {
+	var message slackbot.SlackMessage
+	err := json.Unmarshal([]byte(`{"files": [
+		{"name": "bag.png", "mimetype": "image/png", "filetype": "png", "url_private_download": "https://example.com/bag.png", "original_w": 1080, "original_h": 2340},
+		{"name": "memo.pdf", "mimetype": "application/pdf", "filetype": "pdf", "url_private_download": "https://example.com/memo.pdf"},
+		{"name": "bag2.jpg", "mimetype": "image/jpeg", "filetype": "jpg", "url_private_download": "https://example.com/bag2.jpg"},
+		{"name": "notes.txt", "mimetype": "text/plain", "filetype": "text", "url_private_download": "https://example.com/notes.txt"}
+	]}`), &message)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, skipped := imageFiles(&message)
+	urls := []string{}
+	for _, file := range files {
+		urls = append(urls, file.URL)
+	}
+	if want := []string{"https://example.com/bag.png", "https://example.com/bag2.jpg"}; !reflect.DeepEqual(urls, want) {
+		t.Errorf("files = %v, want %v", urls, want)
+	}
+	if want := []string{"memo.pdf", "notes.txt"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped = %v, want %v", skipped, want)
+	}
+}
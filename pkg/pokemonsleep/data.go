@@ -1,12 +1,49 @@
 package pokemonsleep
 
+// 食材・料理の名前は日本語名（Name）を在庫やレシピの照合に使い、Namesの表記は返信にだけ使う
 type Food struct {
 	Name   string `json:"name"`
 	Num    int    `json:"num"`
 	Energy int    `json:"energy"`
+	// アイコンの見本のファイル名（拡張子なし）
+	Label string `json:"label"`
+
+	// 言語ごとの表記（例: {"en": "Fancy Apple"}）と、食材名として受け付ける別名
+	Names   map[string]string `json:"names,omitempty"`
+	Aliases []string          `json:"aliases,omitempty"`
 }
 
 type Cook struct {
 	Name   string  `json:"name"`
+	Energy int     `json:"energy"`
 	Recipe []*Food `json:"recipe"`
+
+	Names   map[string]string `json:"names,omitempty"`
+	Aliases []string          `json:"aliases,omitempty"`
+}
+
+// localeでの表記（なければ日本語名）
+func (f *Food) LocalName(locale string) string {
+	return localName(f.Name, f.Names, locale)
+}
+
+// localeでの表記（なければ日本語名）
+func (c *Cook) LocalName(locale string) string {
+	return localName(c.Name, c.Names, locale)
+}
+
+func localName(name string, names map[string]string, locale string) string {
+	if n, ok := names[locale]; ok && n != "" {
+		return n
+	}
+	return name
+}
+
+// レシピに必要な食材の合計数
+func (c *Cook) TotalIngredients() int {
+	total := 0
+	for _, food := range c.Recipe {
+		total += food.Num
+	}
+	return total
 }
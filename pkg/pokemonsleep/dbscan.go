@@ -1,92 +1,145 @@
 package pokemonsleep
 
-const (
-	NOISE     = false
-	CLUSTERED = true
+import (
+	"math"
+	"sort"
 )
 
 type Cluster []DetectedText
 
+// 空間インデックスで近傍を探すDBSCAN
+// クラスタは最初の点の入力順に並べ、クラスタ内の点も入力順に並べる
 func Clusterize(objects []DetectedText, minPts int, eps float64) []Cluster {
-	clusters := make([]Cluster, 0)
-	visited := make(map[string]bool)
-	for _, point := range objects {
-		if v, isVisited := visited[point.GetID()]; !v || !isVisited {
-			neighbours := findNeighbours(point, objects, eps)
-			if len(neighbours)+1 >= minPts {
-				cluster := Cluster{}
-				clusters = append(clusters, expandCluster(point, cluster, neighbours, objects, visited, minPts, eps))
-			} else {
-				visited[point.GetID()] = NOISE
+	index := newSpatialIndex(objects, eps)
+	clusterOf := make([]int, len(objects))
+	for i := range clusterOf {
+		clusterOf[i] = -1
+	}
+	visited := make([]bool, len(objects))
+
+	members := [][]int{}
+	for i := range objects {
+		if visited[i] {
+			continue
+		}
+		visited[i] = true
+		neighbours := index.neighbours(i)
+		if len(neighbours)+1 < minPts {
+			continue
+		}
+
+		id := len(members)
+		members = append(members, []int{i})
+		clusterOf[i] = id
+		seed := neighbours
+		for len(seed) > 0 {
+			j := seed[0]
+			seed = seed[1:]
+			if clusterOf[j] < 0 {
+				clusterOf[j] = id
+				members[id] = append(members[id], j)
+			}
+			if visited[j] {
+				continue
+			}
+			visited[j] = true
+			if next := index.neighbours(j); len(next)+1 >= minPts {
+				seed = append(seed, next...)
 			}
 		}
 	}
-	return clusters
-}
 
-// Finds the neighbours from given array
-// depends on Eps variable, which determines
-// the distance limit from the point
-func findNeighbours(point DetectedText, points []DetectedText, eps float64) []DetectedText {
-	neighbours := make([]DetectedText, 0)
-	for _, potNeigb := range points {
-		if point.GetID() != potNeigb.GetID() && potNeigb.Distance(point) <= eps {
-			neighbours = append(neighbours, potNeigb)
+	clusters := make([]Cluster, 0, len(members))
+	for _, m := range members {
+		sort.Ints(m)
+		cluster := make(Cluster, 0, len(m))
+		for _, i := range m {
+			cluster = append(cluster, objects[i])
 		}
+		clusters = append(clusters, cluster)
 	}
-	return neighbours
+	return clusters
 }
 
-// Try to expand existing clutser
-func expandCluster(point DetectedText, cluster Cluster, neighbours, points []DetectedText, visited map[string]bool, minPts int, eps float64) Cluster {
-	cluster = append(cluster, point)
-	visited[point.GetID()] = CLUSTERED
-	seed := make([]DetectedText, len(neighbours))
-	copy(seed, neighbours)
-	index := 0
-	length := len(seed)
-	for index < length {
-		point := seed[index]
-		pointState, isVisited := visited[point.GetID()]
-		if !isVisited {
-			currentNeighbours := findNeighbours(point, points, eps)
-			if len(currentNeighbours)+1 >= minPts {
-				visited[point.GetID()] = CLUSTERED
-				seed = merge(seed, currentNeighbours, visited)
-			}
-		}
+// 近傍探索用の一様グリッド
+// 各点の枠をDistanceと同じ単位に直し、枠が重なるセルすべてに登録する
+type spatialIndex struct {
+	objects  []DetectedText
+	eps      float64
+	cellSize float64
+	cells    map[[2]int][]int
+	bounds   [][4]float64
 
-		if isVisited && !pointState {
-			visited[point.GetID()] = CLUSTERED
-			cluster = append(cluster, point)
-		}
+	// 同じ点を重複して候補にしないための印（問い合わせごとに値を変える）
+	stamp []int
+	query int
+}
 
-		length = len(seed)
-		index++
+func newSpatialIndex(objects []DetectedText, eps float64) *spatialIndex {
+	ret := &spatialIndex{
+		objects: objects,
+		eps:     eps,
+		cells:   make(map[[2]int][]int),
+		bounds:  make([][4]float64, len(objects)),
+		stamp:   make([]int, len(objects)),
 	}
-	cluster = merge(cluster, seed, visited)
-	for _, p := range cluster {
-		visited[p.GetID()] = CLUSTERED
+	// セルは枠の高さ程度にし、1つの枠が多くのセルにまたがらないようにする
+	heights := 0.0
+	for i, object := range objects {
+		ret.bounds[i] = object.distanceBounds()
+		heights += ret.bounds[i][3] - ret.bounds[i][1]
+	}
+	ret.cellSize = eps
+	if len(objects) > 0 && heights/float64(len(objects)) > ret.cellSize {
+		ret.cellSize = heights / float64(len(objects))
+	}
+	if ret.cellSize <= 0 {
+		ret.cellSize = 1
 	}
-	return cluster
-}
 
-func merge(one []DetectedText, two []DetectedText, visited map[string]bool) []DetectedText {
-	mergeMap := make(map[string]DetectedText)
-	putAll(mergeMap, one)
-	putAll(mergeMap, two)
-	merged := make([]DetectedText, 0)
-	for _, val := range mergeMap {
-		merged = append(merged, val)
+	for i, b := range ret.bounds {
+		x0, y0, x1, y1 := ret.cellRange(b, 0)
+		for y := y0; y <= y1; y++ {
+			for x := x0; x <= x1; x++ {
+				ret.cells[[2]int{x, y}] = append(ret.cells[[2]int{x, y}], i)
+			}
+		}
 	}
+	return ret
+}
+
+func (s *spatialIndex) cellRange(b [4]float64, margin float64) (int, int, int, int) {
+	return int(math.Floor((b[0] - margin) / s.cellSize)), int(math.Floor((b[1] - margin) / s.cellSize)),
+		int(math.Floor((b[2] + margin) / s.cellSize)), int(math.Floor((b[3] + margin) / s.cellSize))
+}
 
-	return merged
+// i番目の点からeps以内にある点（入力順）
+func (s *spatialIndex) neighbours(i int) []int {
+	s.query++
+	ret := []int{}
+	point := s.objects[i]
+	x0, y0, x1, y1 := s.cellRange(s.bounds[i], s.eps)
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			for _, j := range s.cells[[2]int{x, y}] {
+				if j == i || s.stamp[j] == s.query {
+					continue
+				}
+				s.stamp[j] = s.query
+				if point.GetID() != s.objects[j].GetID() && s.objects[j].Distance(point) <= s.eps {
+					ret = append(ret, j)
+				}
+			}
+		}
+	}
+	sort.Ints(ret)
+	return ret
 }
 
-// Function to add all values from list to map
-// map keys is then the unique collecton from list
-func putAll(m map[string]DetectedText, list []DetectedText) {
-	for _, val := range list {
-		m[val.GetID()] = val
+// Distanceと同じ単位での枠（Scaleがあればpxを割った値、なければ正規化した座標）
+func (d DetectedText) distanceBounds() [4]float64 {
+	if d.Scale <= 0 {
+		return [4]float64{float64(d.NMinX), float64(d.NMinY), float64(d.NMaxX), float64(d.NMaxY)}
 	}
+	return [4]float64{float64(d.MinX) / d.Scale, float64(d.MinY) / d.Scale, float64(d.MaxX) / d.Scale, float64(d.MaxY) / d.Scale}
 }
@@ -0,0 +1,246 @@
+package pokemonsleep
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	NOISE     = false
+	CLUSTERED = true
+)
+
+// 総当たりで近傍を探す、インデックス導入前のDBSCAN
+// Clusterizeとの結果の突き合わせと速度の比較に使う
+func clusterizeBruteForce(objects []DetectedText, minPts int, eps float64) []Cluster {
+	clusters := make([]Cluster, 0)
+	visited := make(map[string]bool)
+	for _, point := range objects {
+		if v, isVisited := visited[point.GetID()]; !v || !isVisited {
+			neighbours := findNeighbours(point, objects, eps)
+			if len(neighbours)+1 >= minPts {
+				cluster := Cluster{}
+				clusters = append(clusters, expandCluster(point, cluster, neighbours, objects, visited, minPts, eps))
+			} else {
+				visited[point.GetID()] = NOISE
+			}
+		}
+	}
+	return clusters
+}
+
+// Finds the neighbours from given array
+// depends on Eps variable, which determines
+// the distance limit from the point
+func findNeighbours(point DetectedText, points []DetectedText, eps float64) []DetectedText {
+	neighbours := make([]DetectedText, 0)
+	for _, potNeigb := range points {
+		if point.GetID() != potNeigb.GetID() && potNeigb.Distance(point) <= eps {
+			neighbours = append(neighbours, potNeigb)
+		}
+	}
+	return neighbours
+}
+
+// Try to expand existing clutser
+func expandCluster(point DetectedText, cluster Cluster, neighbours, points []DetectedText, visited map[string]bool, minPts int, eps float64) Cluster {
+	cluster = append(cluster, point)
+	visited[point.GetID()] = CLUSTERED
+	seed := make([]DetectedText, len(neighbours))
+	copy(seed, neighbours)
+	index := 0
+	length := len(seed)
+	for index < length {
+		point := seed[index]
+		pointState, isVisited := visited[point.GetID()]
+		if !isVisited {
+			currentNeighbours := findNeighbours(point, points, eps)
+			if len(currentNeighbours)+1 >= minPts {
+				visited[point.GetID()] = CLUSTERED
+				seed = merge(seed, currentNeighbours, visited)
+			}
+		}
+
+		if isVisited && !pointState {
+			visited[point.GetID()] = CLUSTERED
+			cluster = append(cluster, point)
+		}
+
+		length = len(seed)
+		index++
+	}
+	cluster = merge(cluster, seed, visited)
+	for _, p := range cluster {
+		visited[p.GetID()] = CLUSTERED
+	}
+	return cluster
+}
+
+func merge(one []DetectedText, two []DetectedText, visited map[string]bool) []DetectedText {
+	mergeMap := make(map[string]DetectedText)
+	putAll(mergeMap, one)
+	putAll(mergeMap, two)
+	merged := make([]DetectedText, 0)
+	for _, val := range mergeMap {
+		merged = append(merged, val)
+	}
+
+	return merged
+}
+
+// Function to add all values from list to map
+// map keys is then the unique collecton from list
+func putAll(m map[string]DetectedText, list []DetectedText) {
+	for _, val := range list {
+		m[val.GetID()] = val
+	}
+}
+
+// バッグ画面のように、2語ずつの食材名と個数がマス目に並んだOCR結果を作る
+func gridTokens(n int) []DetectedText {
+	const (
+		scale  = 32.0
+		cellW  = 260
+		cellH  = 330
+		perRow = 4
+	)
+	ui := struct{ w, h float32 }{cellW * perRow, float32(cellH * (n/(3*perRow) + 1))}
+	ret := []DetectedText{}
+	for i := 0; len(ret) < n; i++ {
+		x, y := (i%perRow)*cellW+20, (i/perRow)*cellH+60
+		boxes := [][4]int{
+			{x + 140, y, x + 190, y + 35},
+			{x, y + 60, x + 96, y + 92},
+			{x + 98, y + 60, x + 170, y + 92},
+		}
+		for _, b := range boxes {
+			if len(ret) == n {
+				break
+			}
+			ret = append(ret, DetectedText{
+				ID:    strconv.Itoa(len(ret)),
+				Text:  []string{strconv.Itoa(len(ret))},
+				MinX:  b[0],
+				MinY:  b[1],
+				MaxX:  b[2],
+				MaxY:  b[3],
+				NMinX: float32(b[0]) / ui.w,
+				NMinY: float32(b[1]) / ui.h,
+				NMaxX: float32(b[2]) / ui.w,
+				NMaxY: float32(b[3]) / ui.h,
+				Scale: scale,
+			})
+		}
+	}
+	return ret
+}
+
+// クラスタの順序や点の順序によらない、クラスタの分け方
+func clusterKeys(clusters []Cluster) []string {
+	ret := []string{}
+	for _, cluster := range clusters {
+		ids := []string{}
+		for _, point := range cluster {
+			ids = append(ids, point.ID)
+		}
+		sort.Strings(ids)
+		ret = append(ret, strings.Join(ids, ","))
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// 空間インデックスを使っても、総当たりと同じクラスタに分かれる
+// epsがマスの間隔を超えると総当たり版は境界の点を複数のクラスタに入れてしまうので、マスが分かれる範囲で比べる
+func TestClusterizeMatchesBruteForce(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 100, 300} {
+		for _, eps := range []float64{0.1, DefaultClusterEps, 1} {
+			for _, minPts := range []int{1, 2, 3} {
+				t.Run(fmt.Sprintf("n=%d/eps=%g/minPts=%d", n, eps, minPts), func(t *testing.T) {
+					points := gridTokens(n)
+					got := clusterKeys(Clusterize(points, minPts, eps))
+					want := clusterKeys(clusterizeBruteForce(points, minPts, eps))
+					if strings.Join(got, " ") != strings.Join(want, " ") {
+						t.Errorf("clusters differ from brute force\n got: %v\nwant: %v", got, want)
+					}
+				})
+			}
+		}
+	}
+}
+
+var benchSizes = []int{100, 300, 1000, 3000}
+
+func BenchmarkClusterize(b *testing.B) {
+	for _, n := range benchSizes {
+		points := gridTokens(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Clusterize(points, 1, DefaultClusterEps)
+			}
+		})
+	}
+}
+
+func BenchmarkClusterizeBruteForce(b *testing.B) {
+	for _, n := range benchSizes {
+		points := gridTokens(n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				clusterizeBruteForce(points, 1, DefaultClusterEps)
+			}
+		})
+	}
+}
+
+func clusterIDs(clusters []Cluster) [][]string {
+	ret := [][]string{}
+	for _, cluster := range clusters {
+		ids := []string{}
+		for _, point := range cluster {
+			ids = append(ids, point.ID)
+		}
+		ret = append(ret, ids)
+	}
+	return ret
+}
+
+// 何度実行しても、クラスタは最初の点の入力順に、クラスタ内の点は入力順に並ぶ
+// 既定のepsでは、マスごとに個数と2語の食材名の2つのクラスタに分かれる
+func TestClusterizeOrder(t *testing.T) {
+	points := gridTokens(12)
+	reversed := make([]DetectedText, len(points))
+	for i, point := range points {
+		reversed[len(points)-1-i] = point
+	}
+
+	for _, tt := range []struct {
+		name   string
+		points []DetectedText
+		want   [][]string
+	}{
+		{
+			name:   "forward",
+			points: points,
+			want:   [][]string{{"0"}, {"1", "2"}, {"3"}, {"4", "5"}, {"6"}, {"7", "8"}, {"9"}, {"10", "11"}},
+		},
+		{
+			name:   "reversed",
+			points: reversed,
+			want:   [][]string{{"11", "10"}, {"9"}, {"8", "7"}, {"6"}, {"5", "4"}, {"3"}, {"2", "1"}, {"0"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				got := clusterIDs(Clusterize(tt.points, 1, DefaultClusterEps))
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("run %d: clusters = %v, want %v", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
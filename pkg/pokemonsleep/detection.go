@@ -5,95 +5,279 @@ import (
 	"image/color"
 	"math"
 	"regexp"
+	"sort"
 	"strconv"
-	"strings"
+	"unicode/utf8"
 
-	"cloud.google.com/go/vision/v2/apiv1/visionpb"
 	"go.uber.org/zap"
 )
 
+// DBSCANで近くの文字列をまとめるときの距離（UIの文字の高さを1とした値）
+const DefaultClusterEps = 0.3
+
 type DetectResult struct {
 	Image *Image
 
 	DetectedTexts []*DetectedText
 	DetectedFoods map[string]int
+
+	// DetectFoodsで使った食材の一覧（エナジーの計算に使う）
+	Foods []*Food
+
+	// まとめる前のOCR結果と、まとめた文字列ごとの元の文字列（デバッグ用。DetectedTextsと同じ順）
+	RawTexts []*DetectedText
+	Clusters []Cluster
+	// 食材名と個数の対応と、それに使ったマス目（マス目が見つからなければnil）
+	Matches []*FoodMatch
+	Grid    *GridLayout
+
+	// ゲーム画面の領域（上下左右の余白を除く）と、UIの大きさの目安にする文字の高さ(px)
+	UIRegion image.Rectangle
+	UIScale  float64
+
+	// 0ならDefaultClusterEpsを使う
+	ClusterEps float64
+	// nilでなければ、食材名が読めなかったマスをアイコンで補う
+	Icons *IconMatcher
 }
 
-func NewDetectedResult(img *Image, annotations []*visionpb.EntityAnnotation) *DetectResult {
+// 食材名として読んだ文字列と、その個数として読んだ文字列
+type FoodMatch struct {
+	Food    *Food
+	Text    *DetectedText
+	NumText *DetectedText
+	Num     int
+	// 個数の文字列が見つかり、数として読めた
+	NumRead bool
+	// 食材名が読めず、アイコンの照合で見つけた
+	Icon bool
+
+	// 一致度と、次点以降の候補
+	Confidence   float64
+	Alternatives []FoodCandidate
+}
+
+func (d *DetectResult) gridCell(dtext *DetectedText) (int, int, bool) {
+	if d.Grid == nil {
+		return 0, 0, false
+	}
+	return d.Grid.Cell(dtext)
+}
+
+// 確認を促すべき読み取りか（個数が読めない、一致度が低い、次点と紛らわしい）
+func (m *FoodMatch) Uncertain() bool {
+	if !m.NumRead || m.Confidence < LowConfidence {
+		return true
+	}
+	return len(m.Alternatives) > 0 && m.Confidence-m.Alternatives[0].Score < AmbiguousMargin
+}
+
+// 座標はゲーム画面の領域で縦横それぞれ正規化し、距離は文字の高さを単位にする
+// 画像を読み込めればその余白を除いた領域を、読み込めなければ画像全体をゲーム画面とする
+func NewDetectedResult(img *Image, boxes []TextBox) *DetectResult {
+	ui := image.Rect(0, 0, img.Width, img.Height)
+	if decoded, err := img.Decode(); err == nil {
+		ui = DetectUIRegion(decoded)
+	}
+	scale := TextScale(boxes, ui)
+
 	dtexts := []*DetectedText{}
-	for id, annotation := range annotations {
-		dtext := NewDetectedText(strconv.Itoa(id), annotation, img.Width, img.Height, img.Logger)
+	for id, box := range boxes {
+		// 先頭は画像全体の文字列なので、領域の外でも残す
+		if id > 0 && !image.Rect(box.MinX, box.MinY, box.MaxX, box.MaxY).Overlaps(ui) {
+			continue
+		}
+		dtext := NewDetectedText(strconv.Itoa(id), box, ui, scale, img.Logger)
 		dtexts = append(dtexts, dtext)
 	}
 	return &DetectResult{
 		Image:         img,
 		DetectedTexts: dtexts,
 		DetectedFoods: make(map[string]int),
+		UIRegion:      ui,
+		UIScale:       scale,
+	}
+}
+
+// UIの大きさの目安として、文字列の高さの中央値を返す（文字列がなければ画面の幅の3%）
+func TextScale(boxes []TextBox, ui image.Rectangle) float64 {
+	heights := []int{}
+	for i, box := range boxes {
+		if i > 0 && box.MaxY > box.MinY {
+			heights = append(heights, box.MaxY-box.MinY)
+		}
+	}
+	if len(heights) == 0 {
+		return math.Max(1, float64(ui.Dx())*0.03)
 	}
+	return float64(median(heights))
 }
 
 func (d *DetectResult) TidyDetcetdTexts() {
+	eps := d.ClusterEps
+	if eps <= 0 {
+		eps = DefaultClusterEps
+	}
 	points := []DetectedText{}
 	for _, dtext := range d.DetectedTexts {
 		points = append(points, *dtext)
 	}
-	clusters := Clusterize(points[1:], 1, 0.01)
+	// 先頭は画像全体の文字列なので除く
+	if len(d.DetectedTexts) > 0 {
+		d.RawTexts = d.DetectedTexts[1:]
+		points = points[1:]
+	}
+	clusters := Clusterize(points, 1, eps)
 	merged := []*DetectedText{}
 	for _, cluster := range clusters {
 		m := Merge(cluster...)
 		merged = append(merged, m)
 	}
 	d.DetectedTexts = merged
+	d.Clusters = clusters
 }
 
-func (d *DetectResult) DetectFoods(foods []*Food) {
+// matcherはNewFoodMatcherで作った画像の文字列用の索引（Client.FoodMatcherを使い回す）
+func (d *DetectResult) DetectFoods(matcher *FoodMatcher) {
+	d.Foods = matcher.Foods
 	d.TidyDetcetdTexts()
+	d.JoinWords(matcher)
+	names := []*DetectedText{}
 	for _, dtext := range d.DetectedTexts {
-		if isFood, food := dtext.IsFood(foods); isFood {
-			d.DetectedFoods[food.Name] = GetFoodNum(dtext, d.DetectedTexts)
+		if candidates := matcher.Candidates(dtext.Joined()); len(candidates) > 0 {
+			names = append(names, dtext)
+			d.Matches = append(d.Matches, &FoodMatch{
+				Food:         candidates[0].Food,
+				Text:         dtext,
+				Confidence:   candidates[0].Score,
+				Alternatives: candidates[1:],
+			})
+		}
+	}
+
+	// マス目が分かれば同じマスの個数を、分からなければ最も近い個数を対応させる
+	// マスに個数が見つからなければ、隣のマスの個数を取らないよう読めなかったものとする
+	d.Grid = DetectGrid(names)
+	for _, match := range d.Matches {
+		if _, _, ok := d.gridCell(match.Text); ok {
+			match.NumText = d.Grid.FindFoodNumText(match.Text, d.DetectedTexts)
+		} else {
+			match.NumText = FindFoodNumText(match.Text, d.DetectedTexts)
+		}
+		match.Num, match.NumRead = parseFoodNum(match.NumText)
+		if !match.NumRead && d.Image.Logger != nil {
+			d.Image.Logger.Warn("food count not read.", zap.String("food", match.Food.Name), zap.String("text", match.Text.Joined()))
 		}
 	}
+	// 同じ食材が複数見つかれば、個数が読めたもののうち最も一致度の高いものを使う
+	best := make(map[*Food]*FoodMatch)
+	for _, match := range d.Matches {
+		if prev, ok := best[match.Food]; !ok || match.betterThan(prev) {
+			best[match.Food] = match
+		}
+	}
+	for food, match := range best {
+		d.DetectedFoods[food.Name] = match.Num
+	}
+
+	if d.Icons != nil {
+		if err := d.DetectIcons(d.Icons); err != nil && d.Image.Logger != nil {
+			d.Image.Logger.Warn("detect icons failed.", zap.Error(err))
+		}
+	}
+}
+
+// 個数が読めたものを優先し、どちらも読めた（読めなかった）なら一致度の高いほうを優先する
+func (m *FoodMatch) betterThan(other *FoodMatch) bool {
+	if m.NumRead != other.NumRead {
+		return m.NumRead
+	}
+	return m.Confidence > other.Confidence
 }
 
-func (d *DetectResult) GetCookResultString(cooks []*Cook) (string, string) {
-	var makables string
-	var unmakables string
-	for _, cook := range cooks {
-		if d.isMakable(cook) {
-			makables += "    :o: " + cook.Name + "\n"
-			for _, food := range cook.Recipe {
-				makables += "          ・" + food.Name + " x" + strconv.Itoa(food.Num) + "\n"
+// 英語の食材名（例: "Fancy Apple"）は単語の間が空いていて別々の文字列にまとまることがあるので、
+// 同じ行で隣り合う文字列をつなげたほうが食材名によく一致すれば、1つの文字列にまとめる
+func (d *DetectResult) JoinWords(matcher *FoodMatcher) {
+	for d.joinWord(matcher) {
+	}
+}
+
+func (d *DetectResult) joinWord(matcher *FoodMatcher) bool {
+	for i, left := range d.DetectedTexts {
+		for j, right := range d.DetectedTexts {
+			if i == j || !adjacentWords(left, right) {
+				continue
 			}
-		} else {
-			unmakables += "    :x: " + cook.Name + "\n"
-			for _, food := range cook.Recipe {
-				var shortage int
-				if v, ok := d.DetectedFoods[food.Name]; ok {
-					shortage = food.Num - v
-				} else {
-					shortage = food.Num
-				}
-				if shortage <= 0 {
-					unmakables += "          :white_check_mark: " + food.Name + " x" + strconv.Itoa(food.Num) + "\n"
-				} else {
-					unmakables += "          :heavy_multiplication_x: " + food.Name + " x" + strconv.Itoa(food.Num) + " あと" + strconv.Itoa(shortage) + "\n"
-				}
+			joined := Merge(*left, *right)
+			score := bestFoodScore(matcher, joined)
+			if score <= FoodMatchThreshold || score <= bestFoodScore(matcher, left) || score <= bestFoodScore(matcher, right) {
+				continue
+			}
+			d.DetectedTexts[i] = joined
+			d.DetectedTexts = append(d.DetectedTexts[:j], d.DetectedTexts[j+1:]...)
+			if len(d.Clusters) > j {
+				d.Clusters[i] = append(d.Clusters[i], d.Clusters[j]...)
+				d.Clusters = append(d.Clusters[:j], d.Clusters[j+1:]...)
 			}
+			return true
 		}
 	}
-	return "作れるレシピ:\n" + makables, "作れないレシピ:\n" + unmakables
+	return false
 }
 
-func (d *DetectResult) isMakable(cook *Cook) bool {
-	for _, food := range cook.Recipe {
-		num, ok := d.DetectedFoods[food.Name]
-		if !ok {
-			return false
-		} else if num < food.Num {
-			return false
-		}
+// rightがleftの右隣（同じ行で、間が文字の高さ以内）にあり、どちらも個数の文字列ではない
+func adjacentWords(left, right *DetectedText) bool {
+	if numPattern.MatchString(left.Joined()) || numPattern.MatchString(right.Joined()) {
+		return false
+	}
+	height := float64(left.MaxY - left.MinY)
+	if left.Scale > 0 {
+		height = left.Scale
+	}
+	gap := float64(right.MinX - left.MaxX)
+	if gap < -0.2*height || gap > height {
+		return false
+	}
+	center := (right.MinY + right.MaxY) / 2
+	return left.MinY <= center && center <= left.MaxY
+}
+
+func bestFoodScore(matcher *FoodMatcher, dtext *DetectedText) float64 {
+	candidates := matcher.Candidates(dtext.Joined())
+	if len(candidates) == 0 {
+		return 0
+	}
+	return candidates[0].Score
+}
+
+// potは鍋の容量（0以下なら容量を考慮しない）、levelはレシピレベル
+// 作れるレシピは見込みエナジーの高い順に並べる
+func (d *DetectResult) GetCookResultString(cooks []*Cook, pot, level int) (string, string) {
+	makables, unmakables := SplitEvaluations(d.Evaluate(cooks, pot, level))
+	return FormatMakables(Msg(DefaultLocale, "作れるレシピ"), makables, DefaultLocale), FormatUnmakables(Msg(DefaultLocale, "作れないレシピ"), unmakables, pot, DefaultLocale)
+}
+
+// 手持ちの食材で作れて鍋に入りきるレシピを、見込みエナジーの高い順に返す
+func (d *DetectResult) RankCooks(cooks []*Cook, pot, level int) []*Cook {
+	makables, _ := SplitEvaluations(d.Evaluate(cooks, pot, level))
+	ret := []*Cook{}
+	for _, evaluation := range makables {
+		ret = append(ret, evaluation.Cook)
 	}
-	return true
+	return ret
+}
+
+// 手持ちの食材で作れて鍋に入りきるレシピのうち、見込みエナジーが最も高いものを返す（なければnil）
+func (d *DetectResult) BestCook(cooks []*Cook, pot, level int) *Cook {
+	ranked := d.RankCooks(cooks, pot, level)
+	if len(ranked) == 0 {
+		return nil
+	}
+	return ranked[0]
+}
+
+func fitsPot(cook *Cook, pot int) bool {
+	return pot <= 0 || cook.TotalIngredients() <= pot
 }
 
 type DetectedText struct {
@@ -107,53 +291,85 @@ type DetectedText struct {
 	MaxX int `json:"-"`
 	MaxY int `json:"-"`
 
+	// ゲーム画面の領域で縦横それぞれ0〜1に正規化した座標
 	NMinX float32 `json:"-"`
 	NMinY float32 `json:"-"`
 	NMaxX float32 `json:"-"`
 	NMaxY float32 `json:"-"`
+
+	// Distanceの単位にする長さ(px)
+	Scale float64 `json:"-"`
+
+	// まとめる前のOCRの文字列ごとの枠（読む順。Textと同じ並び）
+	Tokens []TextBox `json:"-"`
 }
 
-func NewDetectedText(id string, a *visionpb.EntityAnnotation, w, h int, logger *zap.Logger) *DetectedText {
-	var x1, x2, y1, y2 = w, 0, h, 0
-	for _, vertex := range a.GetBoundingPoly().GetVertices() {
-		x1 = int(math.Min(float64(x1), float64(vertex.GetX())))
-		x2 = int(math.Max(float64(x2), float64(vertex.GetX())))
-		y1 = int(math.Min(float64(y1), float64(vertex.GetY())))
-		y2 = int(math.Max(float64(y2), float64(vertex.GetY())))
-	}
+func NewDetectedText(id string, b TextBox, ui image.Rectangle, scale float64, logger *zap.Logger) *DetectedText {
+	x1 := int(math.Min(float64(ui.Max.X), float64(b.MinX)))
+	x2 := b.MaxX
+	y1 := int(math.Min(float64(ui.Max.Y), float64(b.MinY)))
+	y2 := b.MaxY
+	w, h := float32(ui.Dx()), float32(ui.Dy())
 	return &DetectedText{
 		Logger: logger,
 		ID:     id,
-		Text:   []string{a.Description},
+		Text:   []string{b.Text},
 		MinX:   x1,
 		MinY:   y1,
 		MaxX:   x2,
 		MaxY:   y2,
-		NMinX:  float32(x1) / float32(w),
-		NMinY:  float32(y1) / float32(w),
-		NMaxX:  float32(x2) / float32(w),
-		NMaxY:  float32(y2) / float32(w),
+		NMinX:  float32(x1-ui.Min.X) / w,
+		NMinY:  float32(y1-ui.Min.Y) / h,
+		NMaxX:  float32(x2-ui.Min.X) / w,
+		NMaxY:  float32(y2-ui.Min.Y) / h,
+		Scale:  scale,
+		Tokens: []TextBox{b},
+	}
+}
+
+// 読む順につなげた文字列（英単語どうしの間には空白を入れる）
+func (d DetectedText) Joined() string {
+	var ret string
+	for _, text := range d.Text {
+		last, _ := utf8.DecodeLastRuneInString(ret)
+		first, _ := utf8.DecodeRuneInString(text)
+		if isLatinLetter(last) && isLatinLetter(first) {
+			ret += " "
+		}
+		ret += text
 	}
+	return ret
+}
+
+func isLatinLetter(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
 }
 
 func (d DetectedText) GetID() string {
 	return d.ID
 }
 
+// 文字列の枠の間の距離（Scaleを1とした値。Scaleがなければ正規化した座標での距離）
+// 縦横で正規化の幅が違うと縦長の画面ほど縦の距離が縮むので、px単位の距離を文字の高さで割る
 func (d DetectedText) Distance(other DetectedText) float64 {
-	return d.NDistanceFrom(other)
+	if d.Scale <= 0 {
+		return d.NDistanceFrom(other)
+	}
+	return d.DistanceFrom(other) / d.Scale
 }
 
 func (d DetectedText) DistanceFrom(other DetectedText) float64 {
 	var dx, dy float64
 	if (d.MinX <= other.MinX && other.MinX <= d.MaxX) ||
-		(d.MinX <= other.MaxX && other.MaxX <= d.MaxX) {
+		(d.MinX <= other.MaxX && other.MaxX <= d.MaxX) ||
+		(other.MinX <= d.MinX && d.MinX <= other.MaxX) {
 		dx = 0
 	} else {
 		dx = math.Min(math.Abs(float64(d.MinX-other.MaxX)), math.Abs(float64(d.MaxX-other.MinX)))
 	}
 	if (d.MinY <= other.MinY && other.MinY <= d.MaxY) ||
-		(d.MinY <= other.MaxY && other.MaxY <= d.MaxY) {
+		(d.MinY <= other.MaxY && other.MaxY <= d.MaxY) ||
+		(other.MinY <= d.MinY && d.MinY <= other.MaxY) {
 		dy = 0
 	} else {
 		dy = math.Min(math.Abs(float64(d.MinY-other.MaxY)), math.Abs(float64(d.MaxY-other.MinY)))
@@ -185,90 +401,96 @@ func (d DetectedText) NDistanceFrom(other DetectedText) float64 {
 	return dist
 }
 
-func (d *DetectedText) IsFood(foods []*Food) (bool, *Food) {
-	acc := make(map[*Food]float64)
-	for _, food := range foods {
-		chars := len(food.Name)
-		match := 0
-		ans := food.Name
-		for _, text := range d.Text {
-			if strings.Contains(ans, text) {
-				match += len(text)
-				ans = strings.Replace(ans, text, "", 1)
-			} else {
-				match = int(math.Max(float64(match-len(text)), float64(0)))
-			}
-		}
-		match = int(math.Max(float64(match-len(ans)), float64(0)))
-		accuracy := float64(match) / float64(chars)
-		if accuracy > 0.5 {
-			acc[food] = accuracy
-		}
-	}
+const (
+	// 一致度がこれを超える候補だけを食材とみなす
+	FoodMatchThreshold = 0.5
+	// 一致度がこれ未満か、次点との差がAmbiguousMargin未満なら、確認するよう返信に添える
+	LowConfidence   = 0.8
+	AmbiguousMargin = 0.1
+)
 
-	if len(acc) == 0 {
+// 食材名の候補と、OCRの文字列との一致度（0〜1）
+type FoodCandidate struct {
+	Food  *Food
+	Score float64
+}
+
+func (d *DetectedText) IsFood(foods []*Food) (bool, *Food) {
+	candidates := d.FoodCandidates(NewFoodMatcher(foods))
+	if len(candidates) == 0 {
 		return false, nil
 	}
+	return true, candidates[0].Food
+}
 
-	var max float64
-	var maxfood *Food
-	for k, v := range acc {
-		if max < v {
-			max = v
-			maxfood = k
-		}
-	}
-	return true, maxfood
+// 一致度がFoodMatchThresholdを超える食材を、一致度の高い順に返す（同じ一致度ならfoodsの順）
+// matcherはNewFoodMatcherで作った索引（何度も照合するときは使い回す）
+func (d *DetectedText) FoodCandidates(matcher *FoodMatcher) []FoodCandidate {
+	return matcher.Candidates(d.Joined())
 }
 
-var numPattern = regexp.MustCompile(`x([0-9]+)`)
+var numPattern = regexp.MustCompile(`[xX×][\s　]*([0-9]+)`)
 
-func GetFoodNum(foodtext *DetectedText, dtexts []*DetectedText) int {
-	minDist := foodtext.Distance(*dtexts[0])
-	numText := dtexts[0]
+// 食材名に最も近い"x個数"の文字列を返す（なければnil）
+func FindFoodNumText(foodtext *DetectedText, dtexts []*DetectedText) *DetectedText {
+	var numText *DetectedText
+	minDist := 0.0
 	for _, dtext := range dtexts {
-		if numPattern.Match([]byte(dtext.Text[0])) {
+		if dtext != foodtext && numPattern.MatchString(dtext.Text[0]) {
 			dist := foodtext.Distance(*dtext)
-			if dist < minDist {
+			if numText == nil || dist < minDist {
 				numText = dtext
 				minDist = dist
 			}
 		}
 	}
+	return numText
+}
 
-	num, err := strconv.Atoi(numText.Text[0][1:])
+// "x個数"の文字列から個数を読む（読めなければfalse）
+func parseFoodNum(numText *DetectedText) (int, bool) {
+	if numText == nil {
+		return 0, false
+	}
+	m := numPattern.FindStringSubmatch(numText.Joined())
+	if m == nil {
+		return 0, false
+	}
+	num, err := strconv.Atoi(m[1])
 	if err != nil {
-		return 0
+		return 0, false
 	}
-	return num
+	return num, true
 }
 
-func (d *DetectedText) DrawRect(canvas *image.RGBA) {
-	lineColor := color.RGBA{R: 255, G: 0, B: 0, A: 128}
-	for i := d.MinX; i < d.MaxX; i++ {
-		canvas.Set(i, d.MinY, lineColor)
-		canvas.Set(i, d.MinY-1, lineColor)
-		canvas.Set(i, d.MinY+1, lineColor)
-		canvas.Set(i, d.MaxY, lineColor)
-		canvas.Set(i, d.MaxY, lineColor)
-		canvas.Set(i, d.MaxY, lineColor)
-	}
-
-	for i := d.MinY; i < d.MaxY; i++ {
-		canvas.Set(d.MinX, i, lineColor)
-		canvas.Set(d.MinX-1, i, lineColor)
-		canvas.Set(d.MinX+1, i, lineColor)
-		canvas.Set(d.MaxX, i, lineColor)
-		canvas.Set(d.MaxX, i, lineColor)
-		canvas.Set(d.MaxX, i, lineColor)
+// 文字列の枠をwidthの太さで描く
+func (d *DetectedText) DrawRect(canvas *image.RGBA, lineColor color.Color, width int) {
+	for w := 0; w < width; w++ {
+		for i := d.MinX - w; i <= d.MaxX+w; i++ {
+			canvas.Set(i, d.MinY-w, lineColor)
+			canvas.Set(i, d.MaxY+w, lineColor)
+		}
+		for i := d.MinY - w; i <= d.MaxY+w; i++ {
+			canvas.Set(d.MinX-w, i, lineColor)
+			canvas.Set(d.MaxX+w, i, lineColor)
+		}
 	}
 }
 
+// 文字列を読む順（上の行から、行の中は左から）に並べてまとめる
 func Merge(dtexts ...DetectedText) *DetectedText {
+	tokens := ReadingOrder(dtexts)
 	ret := dtexts[0]
-	for i := 1; i < len(dtexts); i++ {
-		dtext := dtexts[i]
+	ret.Text = nil
+	ret.Tokens = nil
+	for i, dtext := range tokens {
 		ret.Text = append(ret.Text, dtext.Text...)
+		ret.Tokens = append(ret.Tokens, dtext.Tokens...)
+		if i == 0 {
+			ret.MinX, ret.MinY, ret.MaxX, ret.MaxY = dtext.MinX, dtext.MinY, dtext.MaxX, dtext.MaxY
+			ret.NMinX, ret.NMinY, ret.NMaxX, ret.NMaxY = dtext.NMinX, dtext.NMinY, dtext.NMaxX, dtext.NMaxY
+			continue
+		}
 		ret.MinX = int(math.Min(float64(ret.MinX), float64(dtext.MinX)))
 		ret.MaxX = int(math.Max(float64(ret.MaxX), float64(dtext.MaxX)))
 		ret.MinY = int(math.Min(float64(ret.MinY), float64(dtext.MinY)))
@@ -281,6 +503,36 @@ func Merge(dtexts ...DetectedText) *DetectedText {
 	return &ret
 }
 
+// 文字列を読む順に並べ替える
+// 縦の中心が同じ行の上下の範囲に入るものを1行とし、行は上から、行の中は左から並べる
+func ReadingOrder(dtexts []DetectedText) []DetectedText {
+	sorted := append([]DetectedText{}, dtexts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].MinY+sorted[i].MaxY < sorted[j].MinY+sorted[j].MaxY
+	})
+
+	lines := [][]DetectedText{}
+	var minY, maxY int
+	for _, dtext := range sorted {
+		center := (dtext.MinY + dtext.MaxY) / 2
+		if len(lines) > 0 && minY <= center && center <= maxY {
+			lines[len(lines)-1] = append(lines[len(lines)-1], dtext)
+			continue
+		}
+		lines = append(lines, []DetectedText{dtext})
+		minY, maxY = dtext.MinY, dtext.MaxY
+	}
+
+	ret := []DetectedText{}
+	for _, line := range lines {
+		sort.SliceStable(line, func(i, j int) bool {
+			return line[i].MinX < line[j].MinX
+		})
+		ret = append(ret, line...)
+	}
+	return ret
+}
+
 func In(word string, words []string) bool {
 	for _, w := range words {
 		if w == word {
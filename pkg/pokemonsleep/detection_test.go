@@ -0,0 +1,224 @@
+package pokemonsleep
+
+import (
+	"context"
+	"image"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// 実際のスクリーンショットをVision APIでOCRして記録したFixture（go run ./cmd fixture record）
+	fixtureDir = "../../data/fixtures"
+	// 手で作ったOCR結果（実際の画面にない並びや言語を補う）
+	syntheticFixtureDir = "../../data/fixtures/synthetic"
+)
+
+func newTestClient(t *testing.T, detector TextDetector) *Client {
+	t.Helper()
+	client, err := NewClientWithDetector("", detector, "../../data/foods.json", "../../data/cooks.json", zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// 記録済みOCR結果（data/fixtures）と手で作ったOCR結果（data/fixtures/synthetic）による食材検出のゴールデンテスト
+func TestFixtures(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		dir       string
+		synthetic bool
+	}{
+		{name: "recorded", dir: fixtureDir, synthetic: false},
+		{name: "synthetic", dir: syntheticFixtureDir, synthetic: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fixtures, err := LoadFixtures(tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(fixtures) == 0 {
+				if !tt.synthetic {
+					t.Skipf("no recorded fixtures in %s. record screenshots with `go run ./cmd fixture record IMAGE`", tt.dir)
+				}
+				t.Fatalf("no fixtures found in %s", tt.dir)
+			}
+			for _, fixture := range fixtures {
+				if fixture.Synthetic != tt.synthetic {
+					t.Errorf("%s: synthetic = %v, but it is in %s", fixture.Name, fixture.Synthetic, tt.dir)
+				}
+			}
+			testFixtures(t, newTestClient(t, NewReplayDetector(tt.dir)), fixtures)
+		})
+	}
+}
+
+func testFixtures(t *testing.T, client *Client, fixtures []*Fixture) {
+	for _, fixture := range fixtures {
+		fixture := fixture
+		t.Run(fixture.Name, func(t *testing.T) {
+			// 記録したOCR結果をReplayDetector経由で読み、本番と同じ経路で検出する
+			dres, err := client.DetectFoods(context.Background(), fixture.Image(client.Logger))
+			if err != nil {
+				t.Fatal(err)
+			}
+			detected := dres.DetectedFoods
+
+			names := []string{}
+			for name := range fixture.Expected {
+				names = append(names, name)
+			}
+			for name := range detected {
+				if _, ok := fixture.Expected[name]; !ok {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				want, wantOk := fixture.Expected[name]
+				got, gotOk := detected[name]
+				switch {
+				case !gotOk:
+					t.Errorf("%s: missing (want x%d)", name, want)
+				case !wantOk:
+					t.Errorf("%s: unexpected x%d", name, got)
+				case got != want:
+					t.Errorf("%s: got x%d, want x%d", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// 同じ食材の名前が複数読めても、個数が読めたほうの個数を使う
+func TestDetectFoodsKeepsReadCount(t *testing.T) {
+	fixture, err := LoadFixture(syntheticFixtureDir, "bag_all_foods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 最後の行の下に、個数の読めない"とくせんリンゴ"を足す
+	fixture.Boxes = append(fixture.Boxes,
+		TextBox{Text: "とくせん", MinX: 80, MinY: 1850, MaxX: 176, MaxY: 1882},
+		TextBox{Text: "リンゴ", MinX: 178, MinY: 1850, MaxX: 250, MaxY: 1882},
+	)
+	client := newTestClient(t, NewReplayDetector(syntheticFixtureDir))
+
+	dres := fixture.Detect(client.FoodMatcher, client.Logger)
+	unread := 0
+	for _, match := range dres.Matches {
+		if match.Food.Name == "とくせんリンゴ" && !match.NumRead {
+			unread++
+		}
+	}
+	if unread != 1 {
+		t.Fatalf("unread とくせんリンゴ = %d, want 1", unread)
+	}
+	if got, want := dres.DetectedFoods["とくせんリンゴ"], fixture.Expected["とくせんリンゴ"]; got != want {
+		t.Errorf("とくせんリンゴ: got x%d, want x%d", got, want)
+	}
+}
+
+func mergeTestText(text string, minX, minY, maxX, maxY int) DetectedText {
+	box := TextBox{Text: text, MinX: minX, MinY: minY, MaxX: maxX, MaxY: maxY}
+	return *NewDetectedText(text, box, image.Rect(0, 0, 1080, 2340), 32, zap.NewNop())
+}
+
+// OCRの返す順ではなく、読む順（上の行から、行の中は左から）にまとめる
+func TestMerge(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		dtexts []DetectedText
+		want   []string
+	}{
+		{
+			name: "same line",
+			dtexts: []DetectedText{
+				mergeTestText("リンゴ", 178, 1850, 250, 1882),
+				mergeTestText("とくせん", 80, 1850, 176, 1882),
+			},
+			want: []string{"とくせん", "リンゴ"},
+		},
+		{
+			// 行の中で上下に少しずれていても同じ行とみなす
+			name: "same line with jitter",
+			dtexts: []DetectedText{
+				mergeTestText("リンゴ", 178, 1846, 250, 1880),
+				mergeTestText("とくせん", 80, 1852, 176, 1884),
+			},
+			want: []string{"とくせん", "リンゴ"},
+		},
+		{
+			// 折り返した名前は、左にあっても下の行を後にする
+			name: "wrapped",
+			dtexts: []DetectedText{
+				mergeTestText("リンゴ", 80, 1890, 152, 1922),
+				mergeTestText("とくせん", 100, 1850, 196, 1882),
+			},
+			want: []string{"とくせん", "リンゴ"},
+		},
+		{
+			name: "english",
+			dtexts: []DetectedText{
+				mergeTestText("Apple", 200, 1850, 280, 1882),
+				mergeTestText("Fancy", 100, 1850, 190, 1882),
+			},
+			want: []string{"Fancy", "Apple"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := Merge(tt.dtexts...)
+			if !reflect.DeepEqual(merged.Text, tt.want) {
+				t.Errorf("Text = %v, want %v", merged.Text, tt.want)
+			}
+			tokens := []string{}
+			for _, token := range merged.Tokens {
+				tokens = append(tokens, token.Text)
+			}
+			if !reflect.DeepEqual(tokens, tt.want) {
+				t.Errorf("Tokens = %v, want %v", tokens, tt.want)
+			}
+
+			// 枠はまとめた文字列すべてを囲む
+			want := image.Rectangle{}
+			for _, dtext := range tt.dtexts {
+				want = want.Union(image.Rect(dtext.MinX, dtext.MinY, dtext.MaxX, dtext.MaxY))
+			}
+			if got := image.Rect(merged.MinX, merged.MinY, merged.MaxX, merged.MaxY); got != want {
+				t.Errorf("box = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+// OCRが名前の後半を先に返しても、前半と後半をつないだ名前で照合する
+func TestDetectFoodsReadingOrder(t *testing.T) {
+	fixture, err := LoadFixture(syntheticFixtureDir, "bag_all_foods")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, second := -1, -1
+	for i, box := range fixture.Boxes {
+		if i > 0 && box.Text == "とくせん" && i+1 < len(fixture.Boxes) && fixture.Boxes[i+1].Text == "リンゴ" {
+			first, second = i, i+1
+		}
+	}
+	if first < 0 {
+		t.Fatal("とくせんリンゴ is not in the fixture")
+	}
+	fixture.Boxes[first], fixture.Boxes[second] = fixture.Boxes[second], fixture.Boxes[first]
+	client := newTestClient(t, NewReplayDetector(syntheticFixtureDir))
+
+	dres := fixture.Detect(client.FoodMatcher, client.Logger)
+	if got, want := dres.DetectedFoods["とくせんリンゴ"], fixture.Expected["とくせんリンゴ"]; got != want {
+		t.Errorf("とくせんリンゴ: got x%d, want x%d", got, want)
+	}
+	if !reflect.DeepEqual(dres.DetectedFoods, fixture.Expected) {
+		t.Errorf("DetectedFoods = %v, want %v", dres.DetectedFoods, fixture.Expected)
+	}
+}
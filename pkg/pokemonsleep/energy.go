@@ -0,0 +1,123 @@
+package pokemonsleep
+
+import (
+	"math"
+	"sort"
+)
+
+// レシピに使う食材の合計数ごとのレシピボーナス（ゲーム内の値の近似）
+// 料理の基本エナジーは 食材エナジーの合計 x (1 + ボーナス)
+var recipeBonuses = []struct {
+	MaxIngredients int
+	Bonus          float64
+}{
+	{7, 0.06},
+	{15, 0.11},
+	{22, 0.17},
+	{30, 0.25},
+	{40, 0.35},
+	{52, 0.48},
+	{math.MaxInt, 0.61},
+}
+
+// レシピレベルごとのエナジー倍率の上乗せ分（Lv1が0）
+// 表より大きいレベルは最大値で頭打ちにする
+var recipeLevelBonuses = []float64{
+	0, 0.02, 0.04, 0.06, 0.08, 0.09, 0.11, 0.13, 0.16, 0.18,
+	0.19, 0.21, 0.23, 0.24, 0.26, 0.28, 0.31, 0.33, 0.35, 0.37,
+	0.40, 0.42, 0.45, 0.47, 0.50, 0.52, 0.55, 0.58, 0.61, 0.64,
+}
+
+func RecipeBonus(ingredients int) float64 {
+	if ingredients <= 0 {
+		return 0
+	}
+	for _, b := range recipeBonuses {
+		if ingredients <= b.MaxIngredients {
+			return b.Bonus
+		}
+	}
+	return 0
+}
+
+func RecipeLevelMultiplier(level int) float64 {
+	if level <= 1 {
+		return 1
+	}
+	if level > len(recipeLevelBonuses) {
+		level = len(recipeLevelBonuses)
+	}
+	return 1 + recipeLevelBonuses[level-1]
+}
+
+func FindFood(foods []*Food, name string) *Food {
+	for _, food := range foods {
+		if food.Name == name {
+			return food
+		}
+	}
+	return nil
+}
+
+// 料理の基本エナジー（レシピLv1）
+// cooks.jsonにenergyがあればそれを、なければ食材のエナジーとレシピボーナスから計算する
+func (c *Cook) BaseEnergy(foods []*Food) int {
+	if c.Energy > 0 {
+		return c.Energy
+	}
+	sum := 0
+	for _, ingredient := range c.Recipe {
+		if food := FindFood(foods, ingredient.Name); food != nil {
+			sum += food.Energy * ingredient.Num
+		}
+	}
+	return int(math.Round(float64(sum) * (1 + RecipeBonus(c.TotalIngredients()))))
+}
+
+// レシピレベルを考慮した料理のエナジー
+func (c *Cook) LeveledEnergy(foods []*Food, level int) int {
+	return int(math.Round(float64(c.BaseEnergy(foods)) * RecipeLevelMultiplier(level)))
+}
+
+// 鍋の空きに入れる追加食材のエナジー
+// レシピで使った残りの食材を、エナジーの高い順に鍋の空きが埋まるまで入れる
+func FillerEnergy(cook *Cook, foods []*Food, inventory map[string]int, pot int) int {
+	space := pot - cook.TotalIngredients()
+	if pot <= 0 || space <= 0 {
+		return 0
+	}
+
+	left := make(map[string]int)
+	for name, num := range inventory {
+		left[name] = num
+	}
+	for _, ingredient := range cook.Recipe {
+		left[ingredient.Name] -= ingredient.Num
+	}
+
+	candidates := []*Food{}
+	for _, food := range foods {
+		if left[food.Name] > 0 {
+			candidates = append(candidates, food)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Energy > candidates[j].Energy
+	})
+
+	energy := 0
+	for _, food := range candidates {
+		n := int(math.Min(float64(space), float64(left[food.Name])))
+		energy += food.Energy * n
+		space -= n
+		if space == 0 {
+			break
+		}
+	}
+	return energy
+}
+
+// 鍋いっぱいに作ったときに見込めるエナジー
+func (c *Cook) ExpectedEnergy(foods []*Food, inventory map[string]int, pot, level int) int {
+	return c.LeveledEnergy(foods, level) + FillerEnergy(c, foods, inventory, pot)
+}
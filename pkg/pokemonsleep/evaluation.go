@@ -0,0 +1,88 @@
+package pokemonsleep
+
+import (
+	"sort"
+)
+
+// レシピの食材1つ分の必要数と手持ちの数
+type IngredientEvaluation struct {
+	Name     string `json:"name"`
+	Need     int    `json:"need"`
+	Have     int    `json:"have"`
+	Shortage int    `json:"shortage"`
+}
+
+// 在庫に対するレシピ1つ分の評価
+type RecipeEvaluation struct {
+	Cook *Cook  `json:"-"`
+	Name string `json:"name"`
+
+	// 食材が足りていて鍋に入りきる
+	Makable bool `json:"makable"`
+	// 食材は足りているかに関わらず、鍋に入りきらない
+	TooLarge bool `json:"too_large"`
+
+	TotalIngredients int `json:"total_ingredients"`
+	// 作れる場合は鍋の空きを追加食材で埋めたときの見込みエナジー、作れない場合はレシピ通りに作ったときのエナジー
+	Energy int `json:"energy"`
+
+	Ingredients []IngredientEvaluation `json:"ingredients"`
+}
+
+// 在庫の食材でレシピを1つずつ評価する（cooksの順に返す）
+// potは鍋の容量（0以下なら容量を考慮しない）、levelはレシピレベル
+func (d *DetectResult) Evaluate(cooks []*Cook, pot, level int) []*RecipeEvaluation {
+	ret := []*RecipeEvaluation{}
+	for _, cook := range cooks {
+		ret = append(ret, d.evaluate(cook, pot, level))
+	}
+	return ret
+}
+
+func (d *DetectResult) evaluate(cook *Cook, pot, level int) *RecipeEvaluation {
+	ret := &RecipeEvaluation{
+		Cook:             cook,
+		Name:             cook.Name,
+		TooLarge:         !fitsPot(cook, pot),
+		TotalIngredients: cook.TotalIngredients(),
+	}
+	enough := true
+	for _, food := range cook.Recipe {
+		have := d.DetectedFoods[food.Name]
+		ingredient := IngredientEvaluation{
+			Name: food.Name,
+			Need: food.Num,
+			Have: have,
+		}
+		if have < food.Num {
+			ingredient.Shortage = food.Num - have
+			enough = false
+		}
+		ret.Ingredients = append(ret.Ingredients, ingredient)
+	}
+
+	ret.Makable = enough && !ret.TooLarge
+	if ret.Makable {
+		ret.Energy = cook.ExpectedEnergy(d.Foods, d.DetectedFoods, pot, level)
+	} else {
+		ret.Energy = cook.LeveledEnergy(d.Foods, level)
+	}
+	return ret
+}
+
+// 作れるレシピ（見込みエナジーの高い順）と作れないレシピ（cooksの順）に分ける
+func SplitEvaluations(evaluations []*RecipeEvaluation) ([]*RecipeEvaluation, []*RecipeEvaluation) {
+	makables := []*RecipeEvaluation{}
+	unmakables := []*RecipeEvaluation{}
+	for _, evaluation := range evaluations {
+		if evaluation.Makable {
+			makables = append(makables, evaluation)
+		} else {
+			unmakables = append(unmakables, evaluation)
+		}
+	}
+	sort.SliceStable(makables, func(i, j int) bool {
+		return makables[i].Energy > makables[j].Energy
+	})
+	return makables, unmakables
+}
@@ -0,0 +1,113 @@
+package pokemonsleep
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// 記録したOCR結果（<name>.json）と期待する検出結果（<name>.expected.json）の組
+type Fixture struct {
+	Name string `json:"-"`
+
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+	Expected map[string]int `json:"expected"`
+	// 実機のOCR結果ではなく、手で作ったOCR結果であれば true
+	Synthetic bool `json:"synthetic,omitempty"`
+
+	Boxes []TextBox `json:"-"`
+}
+
+// 画像ファイルのパスからFixture名（拡張子を除いたファイル名）を求める
+func FixtureName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+func FixturePaths(dir, name string) (string, string) {
+	return filepath.Join(dir, name+".json"), filepath.Join(dir, name+".expected.json")
+}
+
+func LoadFixture(dir, name string) (*Fixture, error) {
+	annotationsPath, expectedPath := FixturePaths(dir, name)
+
+	data, err := os.ReadFile(expectedPath)
+	if err != nil {
+		return nil, fmt.Errorf("open file failed: %w", err)
+	}
+	ret := &Fixture{Name: name}
+	if err := json.Unmarshal(data, ret); err != nil {
+		return nil, fmt.Errorf("json unmarshal (%s) failed: %w", expectedPath, err)
+	}
+
+	annotations, err := LoadAnnotations(annotationsPath)
+	if err != nil {
+		return nil, fmt.Errorf("load annotations (%s) failed: %w", annotationsPath, err)
+	}
+	ret.Boxes = NewTextBoxes(annotations)
+	return ret, nil
+}
+
+// dir 以下の全Fixtureを名前順に読み込む
+func LoadFixtures(dir string) ([]*Fixture, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.expected.json"))
+	if err != nil {
+		return nil, fmt.Errorf("glob fixtures failed: %w", err)
+	}
+	sort.Strings(paths)
+
+	ret := []*Fixture{}
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".expected.json")
+		fixture, err := LoadFixture(dir, name)
+		if err != nil {
+			return nil, fmt.Errorf("load fixture (%s) failed: %w", name, err)
+		}
+		ret = append(ret, fixture)
+	}
+	return ret, nil
+}
+
+func (f *Fixture) Save(dir string) error {
+	annotationsPath, expectedPath := FixturePaths(dir, f.Name)
+	if err := SaveAnnotations(annotationsPath, NewAnnotations(f.Boxes)); err != nil {
+		return fmt.Errorf("save annotations (%s) failed: %w", annotationsPath, err)
+	}
+	data, err := json.MarshalIndent(f, "", "    ")
+	if err != nil {
+		return fmt.Errorf("json marshal failed: %w", err)
+	}
+	if err := os.WriteFile(expectedPath, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("write file failed: %w", err)
+	}
+	return nil
+}
+
+// Fixture名のついた画像。ReplayDetectorに渡すと記録したOCR結果（<name>.json）が読まれる
+// 画像そのものは記録していないので、アイコン照合やデバッグ用の画像の描画はできない
+func (f *Fixture) Image(logger *zap.Logger) *Image {
+	return &Image{
+		Logger: logger,
+		Bytes:  NewNamedReader(f.Name, bytes.NewReader(nil)),
+		Width:  f.Width,
+		Height: f.Height,
+	}
+}
+
+// 記録したOCR結果から直接食材を検出する（記録時に期待値の雛形を作るのに使う）
+func (f *Fixture) Detect(matcher *FoodMatcher, logger *zap.Logger) *DetectResult {
+	img := &Image{
+		Logger: logger,
+		Width:  f.Width,
+		Height: f.Height,
+	}
+	dres := NewDetectedResult(img, f.Boxes)
+	dres.DetectFoods(matcher)
+	return dres
+}
@@ -0,0 +1,152 @@
+package pokemonsleep
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// バッグ画面の食材のマス目
+// 各マスはアイコンの右上に個数、アイコンの下に食材名が並ぶので、食材名の中心から列と行を求める
+type GridLayout struct {
+	// 列の中心のX座標（左から）と、行の食材名の下端のY座標（上から）
+	Columns []int
+	Rows    []int
+
+	ColumnPitch int
+	RowPitch    int
+	NameHeight  int
+}
+
+// 食材名の並びからマス目を求める（2マス以上並んでいなければnil）
+func DetectGrid(names []*DetectedText) *GridLayout {
+	if len(names) < 2 {
+		return nil
+	}
+
+	widths, heights := []int{}, []int{}
+	xs, ys := []int{}, []int{}
+	for _, name := range names {
+		widths = append(widths, name.MaxX-name.MinX)
+		heights = append(heights, name.MaxY-name.MinY)
+		xs = append(xs, (name.MinX+name.MaxX)/2)
+		ys = append(ys, name.MaxY)
+	}
+	columns := groupPositions(xs, median(widths)/2)
+	rows := groupPositions(ys, median(heights))
+	if len(columns) < 2 && len(rows) < 2 {
+		return nil
+	}
+
+	ret := &GridLayout{
+		Columns:     columns,
+		Rows:        rows,
+		ColumnPitch: medianGap(columns),
+		RowPitch:    medianGap(rows),
+		NameHeight:  median(heights),
+	}
+	// 1行しか写っていなければ、マスは縦横が同じくらいの大きさとみなす
+	if ret.RowPitch == 0 {
+		ret.RowPitch = ret.ColumnPitch
+	}
+	if ret.ColumnPitch == 0 {
+		ret.ColumnPitch = ret.RowPitch
+	}
+	return ret
+}
+
+// 文字列の中心が含まれるマスの行と列（どのマスにも入らなければok=false）
+func (g *GridLayout) Cell(d *DetectedText) (int, int, bool) {
+	x, y := (d.MinX+d.MaxX)/2, (d.MinY+d.MaxY)/2
+
+	col := -1
+	for i, cx := range g.Columns {
+		if abs(x-cx) <= g.ColumnPitch/2 {
+			col = i
+			break
+		}
+	}
+	// 行は食材名の下端から1行分上までの帯とする
+	row := -1
+	for i, bottom := range g.Rows {
+		if bottom-g.RowPitch < y && y <= bottom {
+			row = i
+			break
+		}
+	}
+	return row, col, row >= 0 && col >= 0
+}
+
+// 同じマスにある"x個数"の文字列を返す（同じマスに複数あれば食材名に最も近いもの、なければnil）
+func (g *GridLayout) FindFoodNumText(foodtext *DetectedText, dtexts []*DetectedText) *DetectedText {
+	row, col, ok := g.Cell(foodtext)
+	if !ok {
+		return nil
+	}
+	var ret *DetectedText
+	minDist := 0.0
+	for _, dtext := range dtexts {
+		if dtext == foodtext || !numPattern.MatchString(dtext.Text[0]) {
+			continue
+		}
+		if r, c, ok := g.Cell(dtext); !ok || r != row || c != col {
+			continue
+		}
+		if dist := foodtext.Distance(*dtext); ret == nil || dist < minDist {
+			ret = dtext
+			minDist = dist
+		}
+	}
+	return ret
+}
+
+// マスの境界を描く
+func (g *GridLayout) Draw(canvas *image.RGBA, c color.Color) {
+	top, bottom := g.Rows[0]-g.RowPitch, g.Rows[len(g.Rows)-1]
+	left, right := g.Columns[0]-g.ColumnPitch/2, g.Columns[len(g.Columns)-1]+g.ColumnPitch/2
+	for _, cx := range g.Columns {
+		drawLine(canvas, image.Pt(cx-g.ColumnPitch/2, top), image.Pt(cx-g.ColumnPitch/2, bottom), c)
+	}
+	drawLine(canvas, image.Pt(right, top), image.Pt(right, bottom), c)
+	for _, y := range append([]int{top}, g.Rows...) {
+		drawLine(canvas, image.Pt(left, y), image.Pt(right, y), c)
+	}
+}
+
+// 座標を並べ、tolerance以内で続くものを1つにまとめてそれぞれの平均を返す
+func groupPositions(positions []int, tolerance int) []int {
+	sorted := append([]int{}, positions...)
+	sort.Ints(sorted)
+
+	ret := []int{}
+	sum, n := 0, 0
+	for i, p := range sorted {
+		if i > 0 && p-sorted[i-1] > tolerance {
+			ret = append(ret, sum/n)
+			sum, n = 0, 0
+		}
+		sum += p
+		n++
+	}
+	if n > 0 {
+		ret = append(ret, sum/n)
+	}
+	return ret
+}
+
+func median(values []int) int {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]int{}, values...)
+	sort.Ints(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func medianGap(positions []int) int {
+	gaps := []int{}
+	for i := 1; i < len(positions); i++ {
+		gaps = append(gaps, positions[i]-positions[i-1])
+	}
+	return median(gaps)
+}
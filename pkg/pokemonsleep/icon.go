@@ -0,0 +1,264 @@
+package pokemonsleep
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"math/bits"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/zap"
+)
+
+// アイコンのハッシュの差がこれ以下なら同じ食材とみなす（64ビット中）
+const DefaultIconThreshold = 10
+
+// 食材アイコンの見本と、スクリーンショットのアイコンを知覚ハッシュ（dHash）で照合する
+// 見本は<Dir>/<foods.jsonのlabel>.pngに置く
+type IconMatcher struct {
+	Hashes    map[*Food]uint64
+	Threshold int
+}
+
+// 見本のアイコンを読み込む（見本のない食材は照合しない）
+func LoadIconMatcher(dir string, foods []*Food) (*IconMatcher, error) {
+	ret := &IconMatcher{
+		Hashes:    make(map[*Food]uint64),
+		Threshold: DefaultIconThreshold,
+	}
+	for _, food := range foods {
+		if food.Label == "" {
+			continue
+		}
+		path := filepath.Join(dir, food.Label+".png")
+		file, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("open file failed: %w", err)
+		}
+		img, _, err := image.Decode(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode icon (%s) failed: %w", path, err)
+		}
+		gray := NewGrayIntegral(img)
+		ret.Hashes[food] = gray.DHash(gray.Bounds)
+	}
+	return ret, nil
+}
+
+// rectの近くでアイコンを探し、最も近い見本の食材を返す（しきい値を超えればnil）
+// 枠の位置や大きさのずれを吸収するため、少しずつずらしたり拡大縮小したりして最も近いものを採る
+func (m *IconMatcher) Match(gray *GrayIntegral, rect image.Rectangle) (*Food, int) {
+	var best *Food
+	bestDist := 64 + 1
+	size := rect.Dx()
+	step := size / 16
+	if step < 1 {
+		step = 1
+	}
+	for _, scale := range []float64{0.9, 1, 1.1} {
+		s := int(float64(size) * scale)
+		for dy := -2 * step; dy <= 2*step; dy += step {
+			for dx := -2 * step; dx <= 2*step; dx += step {
+				cx, cy := (rect.Min.X+rect.Max.X)/2+dx, (rect.Min.Y+rect.Max.Y)/2+dy
+				window := image.Rect(cx-s/2, cy-s/2, cx+s/2, cy+s/2)
+				if !window.In(gray.Bounds) {
+					continue
+				}
+				hash := gray.DHash(window)
+				for food, ref := range m.Hashes {
+					if dist := bits.OnesCount64(hash ^ ref); dist < bestDist || (dist == bestDist && best != nil && food.Name < best.Name) {
+						best, bestDist = food, dist
+					}
+				}
+			}
+		}
+	}
+	if best == nil || bestDist > m.Threshold {
+		return nil, bestDist
+	}
+	return best, bestDist
+}
+
+// 輝度の累積和（任意の矩形の平均輝度を定数時間で求める）
+type GrayIntegral struct {
+	Bounds image.Rectangle
+	sums   []int64
+	stride int
+}
+
+func NewGrayIntegral(img image.Image) *GrayIntegral {
+	b := img.Bounds()
+	gray := image.NewGray(b)
+	draw.Draw(gray, b, img, b.Min, draw.Src)
+
+	w, h := b.Dx(), b.Dy()
+	ret := &GrayIntegral{
+		Bounds: b,
+		sums:   make([]int64, (w+1)*(h+1)),
+		stride: w + 1,
+	}
+	for y := 0; y < h; y++ {
+		var row int64
+		for x := 0; x < w; x++ {
+			row += int64(gray.Pix[y*gray.Stride+x])
+			ret.sums[(y+1)*ret.stride+x+1] = ret.sums[y*ret.stride+x+1] + row
+		}
+	}
+	return ret
+}
+
+// rectの平均輝度
+func (g *GrayIntegral) Mean(rect image.Rectangle) int64 {
+	rect = rect.Intersect(g.Bounds)
+	if rect.Empty() {
+		return 0
+	}
+	x0, y0 := rect.Min.X-g.Bounds.Min.X, rect.Min.Y-g.Bounds.Min.Y
+	x1, y1 := rect.Max.X-g.Bounds.Min.X, rect.Max.Y-g.Bounds.Min.Y
+	sum := g.sums[y1*g.stride+x1] - g.sums[y0*g.stride+x1] - g.sums[y1*g.stride+x0] + g.sums[y0*g.stride+x0]
+	return sum / int64(rect.Dx()*rect.Dy())
+}
+
+// rectを9x8に縮小し、横に隣り合う画素の明暗を64ビットに並べる
+func (g *GrayIntegral) DHash(rect image.Rectangle) uint64 {
+	var ret uint64
+	for y := 0; y < 8; y++ {
+		y0 := rect.Min.Y + rect.Dy()*y/8
+		y1 := rect.Min.Y + rect.Dy()*(y+1)/8
+		prev := int64(-1)
+		for x := 0; x < 9; x++ {
+			x0 := rect.Min.X + rect.Dx()*x/9
+			x1 := rect.Min.X + rect.Dx()*(x+1)/9
+			mean := g.Mean(image.Rect(x0, y0, x1, y1))
+			if x > 0 {
+				ret <<= 1
+				if prev < mean {
+					ret |= 1
+				}
+			}
+			prev = mean
+		}
+	}
+	return ret
+}
+
+// マスのうち、食材名より上のアイコンが描かれている正方形の領域
+func (g *GridLayout) IconRect(row, col int) image.Rectangle {
+	bottom := g.Rows[row] - g.NameHeight
+	top := g.Rows[row] - g.RowPitch
+	size := bottom - top
+	if size > g.ColumnPitch {
+		size = g.ColumnPitch
+	}
+	size = size * 4 / 5
+	cx, cy := g.Columns[col], (top+bottom)/2
+	return image.Rect(cx-size/2, cy-size/2, cx+size/2, cy+size/2)
+}
+
+// OCRで食材名が読めなかったマスを、アイコンの照合で補う
+func (d *DetectResult) DetectIcons(matcher *IconMatcher) error {
+	if d.Grid == nil || len(matcher.Hashes) == 0 {
+		return nil
+	}
+	img, err := d.Image.Decode()
+	if err != nil {
+		return err
+	}
+	gray := NewGrayIntegral(img)
+
+	found := make(map[[2]int]bool)
+	for _, match := range d.Matches {
+		if row, col, ok := d.Grid.Cell(match.Text); ok {
+			found[[2]int{row, col}] = true
+		}
+	}
+	for row := range d.Grid.Rows {
+		for col := range d.Grid.Columns {
+			if found[[2]int{row, col}] {
+				continue
+			}
+			rect := d.Grid.IconRect(row, col)
+			food, dist := matcher.Match(gray, rect)
+			if food == nil {
+				continue
+			}
+			if _, ok := d.DetectedFoods[food.Name]; ok {
+				continue
+			}
+			icon := &DetectedText{
+				Logger: d.Image.Logger,
+				ID:     fmt.Sprintf("icon-%d-%d", row, col),
+				Text:   []string{food.Name},
+				MinX:   rect.Min.X,
+				MinY:   rect.Min.Y,
+				MaxX:   rect.Max.X,
+				MaxY:   rect.Max.Y,
+				Scale:  d.UIScale,
+			}
+			numText := d.Grid.FindFoodNumText(icon, d.DetectedTexts)
+			if numText == nil {
+				continue
+			}
+			if d.Image.Logger != nil {
+				d.Image.Logger.Info("detect food by icon.", zap.String("food", food.Name), zap.Int("row", row), zap.Int("col", col), zap.Int("dist", dist))
+			}
+			num, read := parseFoodNum(numText)
+			d.DetectedFoods[food.Name] = num
+			d.Matches = append(d.Matches, &FoodMatch{
+				Food:       food,
+				Text:       icon,
+				NumText:    numText,
+				Num:        num,
+				NumRead:    read,
+				Icon:       true,
+				Confidence: 1 - float64(dist)/64,
+			})
+		}
+	}
+	return nil
+}
+
+// 食材名が読めたマスのアイコンを<dir>/<label>.pngとして書き出す（既にあれば上書きしない）
+// 手元のスクリーンショットから見本のアイコンを作るのに使う
+func (d *DetectResult) SaveIcons(dir string) error {
+	if d.Grid == nil {
+		return nil
+	}
+	img, err := d.Image.Decode()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create directory failed: %w", err)
+	}
+	for _, match := range d.Matches {
+		row, col, ok := d.Grid.Cell(match.Text)
+		if match.Icon || !ok || match.Food.Label == "" {
+			continue
+		}
+		path := filepath.Join(dir, match.Food.Label+".png")
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		rect := d.Grid.IconRect(row, col).Intersect(img.Bounds())
+		icon := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+		draw.Draw(icon, icon.Bounds(), img, rect.Min, draw.Src)
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("create file failed: %w", err)
+		}
+		err = png.Encode(file, icon)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("encode png failed: %w", err)
+		}
+	}
+	return nil
+}
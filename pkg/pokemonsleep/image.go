@@ -1,6 +1,13 @@
 package pokemonsleep
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/jpeg"
+	_ "image/png"
 	"io"
 
 	"go.uber.org/zap"
@@ -13,6 +20,8 @@ type Image struct {
 
 	Width  int
 	Height int
+
+	decoded image.Image
 }
 
 func NewImage(imageBytes io.Reader, filetype string, width, height int, logger *zap.Logger) (*Image, error) {
@@ -24,3 +33,89 @@ func NewImage(imageBytes io.Reader, filetype string, width, height int, logger *
 		Height: height,
 	}, nil
 }
+
+// Slackに添付された画像ファイル
+type ImageFile struct {
+	Filetype string
+	URL      string
+	Width    int
+	Height   int
+}
+
+// 画像のバイト列から、ヘッダを読んで形式と大きさを求める
+func DecodeImage(data []byte, logger *zap.Logger) (*Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image config failed: %w", err)
+	}
+	return NewImage(bytes.NewReader(data), format, config.Width, config.Height, logger)
+}
+
+// 画像の画素を読み込む（OCRなどで読み終えていても先頭から読み直す。2回目以降は読み込んだものを返す）
+func (img *Image) Decode() (image.Image, error) {
+	if img.decoded != nil {
+		return img.decoded, nil
+	}
+	seeker, ok := img.Bytes.(io.Seeker)
+	if !ok {
+		return nil, errors.New("image bytes is not seekable")
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek image failed: %w", err)
+	}
+	decoded, _, err := image.Decode(img.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("decode image failed: %w", err)
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("seek image failed: %w", err)
+	}
+	img.decoded = decoded
+	return decoded, nil
+}
+
+// 余白の色の許容差（0〜255）
+const uiBorderTolerance = 8
+
+// タブレットの横長の画面や録画などで、ゲーム画面の上下左右に付く単色の余白を除いた領域を返す
+func DetectUIRegion(img image.Image) image.Rectangle {
+	b := img.Bounds()
+	gray := image.NewGray(b)
+	draw.Draw(gray, b, img, b.Min, draw.Src)
+
+	uniform := func(x0, y0, x1, y1 int, ref uint8) bool {
+		for y := y0; y < y1; y++ {
+			for x := x0; x < x1; x++ {
+				v := gray.GrayAt(x, y).Y
+				if v > ref+uiBorderTolerance || ref > v+uiBorderTolerance {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	ret := b
+	ref := gray.GrayAt(b.Min.X, b.Min.Y).Y
+	for ret.Min.X < ret.Max.X && uniform(ret.Min.X, ret.Min.Y, ret.Min.X+1, ret.Max.Y, ref) {
+		ret.Min.X++
+	}
+	ref = gray.GrayAt(b.Max.X-1, b.Max.Y-1).Y
+	for ret.Max.X > ret.Min.X && uniform(ret.Max.X-1, ret.Min.Y, ret.Max.X, ret.Max.Y, ref) {
+		ret.Max.X--
+	}
+	ref = gray.GrayAt(b.Min.X, b.Min.Y).Y
+	for ret.Min.Y < ret.Max.Y && uniform(ret.Min.X, ret.Min.Y, ret.Max.X, ret.Min.Y+1, ref) {
+		ret.Min.Y++
+	}
+	ref = gray.GrayAt(b.Max.X-1, b.Max.Y-1).Y
+	for ret.Max.Y > ret.Min.Y && uniform(ret.Min.X, ret.Max.Y-1, ret.Max.X, ret.Max.Y, ref) {
+		ret.Max.Y--
+	}
+
+	// 画面全体が単色、あるいは余白がほとんどを占めるなら、切り抜かずに画像全体とする
+	if ret.Dx() < b.Dx()/3 || ret.Dy() < b.Dy()/3 {
+		return b
+	}
+	return ret
+}
@@ -0,0 +1,136 @@
+package pokemonsleep
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Slackユーザーごとに最後に検出した食材の在庫
+type Inventory struct {
+	UserID    string         `json:"user_id"`
+	Foods     map[string]int `json:"foods"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// ユーザーごとの在庫を保存するストア
+type InventoryStore interface {
+	// 保存されていなければnilを返す
+	Get(ctx context.Context, userID string) (*Inventory, error)
+	Put(ctx context.Context, inventory *Inventory) error
+}
+
+// ユーザーごとの在庫を Dir 以下の <ユーザーID>.json に保存するInventoryStore
+// ユーザーごとに別のファイルなので、複数のインスタンスから別々のユーザーの在庫を書いても互いに消し合わない
+type FileInventoryStore struct {
+	Dir string
+}
+
+func NewFileInventoryStore(dir string) *FileInventoryStore {
+	return &FileInventoryStore{Dir: dir}
+}
+
+func (f *FileInventoryStore) Get(ctx context.Context, userID string) (*Inventory, error) {
+	path := f.path(userID)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("open file failed: %w", err)
+	}
+	ret := &Inventory{}
+	if err := json.Unmarshal(data, ret); err != nil {
+		return nil, fmt.Errorf("json unmarshal (%s) failed: %w", path, err)
+	}
+	return ret, nil
+}
+
+func (f *FileInventoryStore) Put(ctx context.Context, inventory *Inventory) error {
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return fmt.Errorf("create directory failed: %w", err)
+	}
+	data, err := json.MarshalIndent(inventory, "", "    ")
+	if err != nil {
+		return fmt.Errorf("json marshal failed: %w", err)
+	}
+
+	// 書き込み途中で落ちても壊れないよう、書き込みごとに別の一時ファイルに書いてから置き換える
+	tmp, err := os.CreateTemp(f.Dir, ".inventory-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file failed: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write file failed: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write file failed: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path(inventory.UserID)); err != nil {
+		return fmt.Errorf("rename file failed: %w", err)
+	}
+	return nil
+}
+
+// ユーザーIDにパスの区切りが含まれても Dir の外に出ないようにする
+func (f *FileInventoryStore) path(userID string) string {
+	return filepath.Join(f.Dir, url.PathEscape(userID)+".json")
+}
+
+// 前回の在庫からの増減（変化のない食材は含まない）
+func DiffInventory(prev, cur map[string]int) map[string]int {
+	ret := make(map[string]int)
+	for name, num := range cur {
+		if d := num - prev[name]; d != 0 {
+			ret[name] = d
+		}
+	}
+	for name, num := range prev {
+		if _, ok := cur[name]; !ok && num != 0 {
+			ret[name] = -num
+		}
+	}
+	return ret
+}
+
+// foods.jsonの並び順で食材の一覧を文字列にする（foodsにない食材は名前順で末尾に並べる）
+// 食材名はlocaleの表記にする
+func FormatFoods(foods []*Food, nums map[string]int, locale string) string {
+	tr := NewTranslator(locale, foods)
+	var ret string
+	for _, name := range sortedFoodNames(foods, nums) {
+		ret += tr.Name(name) + " x" + strconv.Itoa(nums[name]) + "\n"
+	}
+	return ret
+}
+
+func FormatInventoryDiff(foods []*Food, diff map[string]int) string {
+	return formatDiff(NewFoodCounts(foods, diff), DefaultLocale)
+}
+
+func sortedFoodNames(foods []*Food, nums map[string]int) []string {
+	names := []string{}
+	known := make(map[string]bool)
+	for _, food := range foods {
+		known[food.Name] = true
+		if _, ok := nums[food.Name]; ok {
+			names = append(names, food.Name)
+		}
+	}
+	others := []string{}
+	for name := range nums {
+		if !known[name] {
+			others = append(others, name)
+		}
+	}
+	sort.Strings(others)
+	return append(names, others...)
+}
@@ -0,0 +1,78 @@
+package pokemonsleep
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 別々のユーザーの在庫を同時に保存しても、どのユーザーの在庫も消えない
+// 同じディレクトリを共有する複数のインスタンスを、ストアを別々に作ることで模す
+func TestFileInventoryStoreConcurrentPut(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewFileInventoryStore(dir)
+
+	const users = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, users)
+	for i := 0; i < users; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- NewFileInventoryStore(dir).Put(ctx, &Inventory{
+				UserID:    fmt.Sprintf("U%03d", i),
+				Foods:     map[string]int{"とくせんリンゴ": i + 1},
+				UpdatedAt: time.Now(),
+			})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < users; i++ {
+		inventory, err := store.Get(ctx, fmt.Sprintf("U%03d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inventory == nil {
+			t.Errorf("U%03d: inventory lost", i)
+			continue
+		}
+		if got := inventory.Foods["とくせんリンゴ"]; got != i+1 {
+			t.Errorf("U%03d: got x%d, want x%d", i, got, i+1)
+		}
+	}
+}
+
+// 保存されていないユーザーはnil、ユーザーIDにパスの区切りがあってもディレクトリの外に書かない
+func TestFileInventoryStoreGet(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store := NewFileInventoryStore(dir + "/inventories")
+
+	inventory, err := store.Get(ctx, "U1")
+	if err != nil || inventory != nil {
+		t.Fatalf("Get(U1) = %v, %v, want nil", inventory, err)
+	}
+	if err := store.Put(ctx, &Inventory{UserID: "../U2", Foods: map[string]int{"マメミート": 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if inventory, err := NewFileInventoryStore(dir).Get(ctx, "U2"); err != nil || inventory != nil {
+		t.Errorf("wrote outside the store directory: %v, %v", inventory, err)
+	}
+	inventory, err = store.Get(ctx, "../U2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inventory == nil || inventory.Foods["マメミート"] != 3 {
+		t.Errorf("Get(../U2) = %v", inventory)
+	}
+}
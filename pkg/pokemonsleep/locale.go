@@ -0,0 +1,165 @@
+package pokemonsleep
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 返信の言語
+const (
+	LocaleJa      = "ja"
+	LocaleEn      = "en"
+	DefaultLocale = LocaleJa
+)
+
+var localePattern = regexp.MustCompile(`(?i)(?:^|[\s　])-{0,2}(?:lang|言語)[\s　]*[:：=＝]?[\s　]*([a-z]{2})(?:[-_][a-z]+)?(?:$|[\s　])`)
+
+// 返信の文言の訳（日本語の文言をキーにする。訳のない文言は日本語のまま返す）
+var catalogs = map[string]map[string]string{
+	LocaleEn: {
+		"食材":       "Ingredients",
+		"サラダ":      "Salad",
+		"カレー":      "Curry",
+		"デザート":     "Dessert",
+		"なし":       "None",
+		"、":        ", ",
+		"確認してください": "Please check",
+
+		"%s(アイコン)":             "%s (icon)",
+		"%s? 数が読めませんでした":       "%s? Could not read the count",
+		"%s? %sとして読みました":       "%s? Read as %s",
+		"（候補: %s）":             " (candidates: %s)",
+		"食材%d種類を読み取りました":       "Read %d ingredients",
+		"食材が見つかりませんでした":        "No ingredients found",
+		"食材%d種類":               "%d ingredients",
+		"鍋%d":                  "Pot %d",
+		"レシピLv%d":              "Recipe Lv %d",
+		"前回から変化はありません":         "No change since last time",
+		"前回からの変化":              "Changes since last time",
+		"「%s」は食材として認識できませんでした": "\"%s\" is not a known ingredient",
+		"「%s」は複数の食材に一致します":     "\"%s\" matches more than one ingredient",
+		"「%s」は画像ではないので読み取りませんでした": "\"%s\" is not an image and was skipped",
+
+		"作れるレシピ":                      "Recipes you can make",
+		"作れないレシピ":                     "Recipes you can't make yet",
+		"%sの作れるレシピ":                   "%s recipes you can make",
+		"%sの作れないレシピ":                  "%s recipes you can't make yet",
+		"%s (%dエナジー)":                 "%s (%d energy)",
+		"鍋%dのおすすめ: %s (%dエナジー)":       "Best for pot %d: %s (%d energy)",
+		"鍋%dで作れるレシピはありません":            "No recipes fit in pot %d",
+		"%s (鍋%dに入りきりません)":            "%s (too large for pot %d)",
+		"%s (鍋に入りきりません: 食材%d個 / 鍋%d)": "%s (too large for the pot: %d ingredients / pot %d)",
+		"あと%d": "%d more",
+
+		"月":               "Mon",
+		"火":               "Tue",
+		"水":               "Wed",
+		"木":               "Thu",
+		"金":               "Fri",
+		"土":               "Sat",
+		"日":               "Sun",
+		"朝":               "breakfast",
+		"昼":               "lunch",
+		"夜":               "dinner",
+		"%s: (作らずに食材を温存)": "%s: (skip and save ingredients)",
+		"合計: %dエナジー":      "Total: %d energy",
+		"%sの献立 (鍋%d):":    "%s meal plan (pot %d):",
+		"今週のカテゴリ（サラダ/カレー/デザート）を指定してください": "Please specify this week's category (salad/curry/dessert)",
+
+		"在庫 (%s時点):": "Inventory (as of %s):",
+		"在庫が保存されていません。食材の画像を添付してください": "No inventory saved yet. Please attach a screenshot of your ingredients",
+		"画像を添付してください":                 "Please attach a screenshot",
+
+		"使い方:": "Usage:",
+		"「%s」というコマンドはありません":               "Unknown command \"%s\"",
+		"コマンドの一覧を表示する":                    "Show available commands",
+		"保存済みの在庫で作れるレシピを表示する":             "Show recipes you can make with your saved inventory",
+		"保存済みの在庫を表示する（食材名と数を添えると在庫を修正する）": "Show your saved inventory (add edits such as \"apple +3\" to correct it)",
+		"保存済みの在庫から1週間の献立を立てる":             "Plan a week of meals from your saved inventory",
+	},
+}
+
+// 対応している言語か
+func SupportedLocale(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok || locale == LocaleJa
+}
+
+// Slackのロケール（例: "en-US"）などを返信の言語にする（対応していなければDefaultLocale）
+func NormalizeLocale(locale string) string {
+	locale = strings.ToLower(locale)
+	if i := strings.IndexAny(locale, "-_"); i >= 0 {
+		locale = locale[:i]
+	}
+	if !SupportedLocale(locale) {
+		return DefaultLocale
+	}
+	return locale
+}
+
+// メンション本文から返信の言語の指定（例: "lang=en", "--lang en", "言語 en"）を読み取る
+func ParseLocale(text string) (string, bool) {
+	m := localePattern.FindStringSubmatch(text)
+	if m == nil || !SupportedLocale(strings.ToLower(m[1])) {
+		return "", false
+	}
+	return strings.ToLower(m[1]), true
+}
+
+// 本文で言語が指定されていればそれを、なければfallback（Slackのユーザーのロケールなど）を使う
+func ResolveLocale(text, fallback string) string {
+	if locale, ok := ParseLocale(text); ok {
+		return locale
+	}
+	return NormalizeLocale(fallback)
+}
+
+// 返信の文言をlocaleに訳してargsを埋め込む
+func Msg(locale, format string, args ...any) string {
+	if s, ok := catalogs[locale][format]; ok {
+		format = s
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// 返信の文言と、食材名・料理名（日本語名）をlocaleの表記にする
+type Translator struct {
+	Locale string
+	names  map[string]string
+}
+
+func NewTranslator(locale string, foods []*Food, cooks ...[]*Cook) *Translator {
+	ret := &Translator{
+		Locale: locale,
+		names:  make(map[string]string),
+	}
+	for _, food := range foods {
+		ret.names[food.Name] = food.LocalName(locale)
+	}
+	for _, cs := range cooks {
+		for _, cook := range cs {
+			ret.names[cook.Name] = cook.LocalName(locale)
+		}
+	}
+	return ret
+}
+
+func (c *Client) Translator(locale string) *Translator {
+	return NewTranslator(locale, c.Foods, c.Salad, c.Curry, c.Desert)
+}
+
+// 食材名・料理名のlocaleでの表記（知らない名前はそのまま返す）
+func (t *Translator) Name(name string) string {
+	if n, ok := t.names[name]; ok {
+		return n
+	}
+	return name
+}
+
+func (t *Translator) Msg(format string, args ...any) string {
+	return Msg(t.Locale, format, args...)
+}
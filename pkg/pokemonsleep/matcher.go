@@ -0,0 +1,323 @@
+package pokemonsleep
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// OCRで取り違えやすい文字と、照合のときに寄せる文字
+var confusables = map[rune]rune{
+	'一': 'ー',
+	'-': 'ー',
+	'‐': 'ー',
+	'―': 'ー',
+	'−': 'ー',
+	'~': 'ー',
+	'〜': 'ー',
+	'口': 'ロ',
+	'力': 'カ',
+	'二': 'ニ',
+	'工': 'エ',
+	'夕': 'タ',
+	'卜': 'ト',
+	'八': 'ハ',
+}
+
+// 照合用に名前を正規化する
+// 全角英数字・半角カナの幅をそろえ（NFKC）、ひらがなをカタカナに、英字を小文字に、取り違えやすい文字を寄せ、空白を除く
+func NormalizeName(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKC.String(s) {
+		switch {
+		case unicode.IsSpace(r):
+			continue
+		case 'ぁ' <= r && r <= 'ゖ':
+			r += 'ァ' - 'ぁ'
+		default:
+			r = unicode.ToLower(r)
+		}
+		if c, ok := confusables[r]; ok {
+			r = c
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// 1文字単位の編集距離（挿入・削除・置換）
+func EditDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// 名前の候補と、入力との一致度（0〜1）
+type NameCandidate struct {
+	// NewNameMatcherに渡した名前の添字
+	Index int
+	Name  string
+	Score float64
+}
+
+// 食材名やレシピ名など、決まった名前の一覧から入力に近いものを探す
+// 正規化した名前の完全一致は表引きで、あいまい一致は2文字の組の転置索引で候補を絞ってから編集距離で比べる
+// 短い名前は組を共有しなくてもthresholdを超えうるので、文字数から届きうるものは索引によらず比べる
+type NameMatcher struct {
+	names      []string
+	normalized [][]rune
+	exact      map[string]int
+	bigrams    map[string][]int
+}
+
+func NewNameMatcher(names []string) *NameMatcher {
+	ret := &NameMatcher{
+		names:   names,
+		exact:   make(map[string]int),
+		bigrams: make(map[string][]int),
+	}
+	for i, name := range names {
+		n := []rune(NormalizeName(name))
+		ret.normalized = append(ret.normalized, n)
+		if _, ok := ret.exact[string(n)]; !ok {
+			ret.exact[string(n)] = i
+		}
+		for _, bigram := range uniqueBigrams(n) {
+			ret.bigrams[bigram] = append(ret.bigrams[bigram], i)
+		}
+	}
+	return ret
+}
+
+// 一致度がthresholdを超える名前を、一致度の高い順に返す（同じ一致度なら名前の一覧の順）
+// 一致度は 1 - 編集距離 / 長い方の文字数
+func (m *NameMatcher) Match(text string, threshold float64) []NameCandidate {
+	t := []rune(NormalizeName(text))
+	if len(t) == 0 {
+		return nil
+	}
+	if i, ok := m.exact[string(t)]; ok {
+		ret := []NameCandidate{{Index: i, Name: m.names[i], Score: 1}}
+		return append(ret, m.fuzzy(t, threshold, i)...)
+	}
+	return m.fuzzy(t, threshold, -1)
+}
+
+func (m *NameMatcher) fuzzy(t []rune, threshold float64, skip int) []NameCandidate {
+	shared := make(map[int]bool)
+	for _, bigram := range uniqueBigrams(t) {
+		for _, i := range m.bigrams[bigram] {
+			shared[i] = true
+		}
+	}
+	// 2文字の組を1つも共有しない名前は、編集距離の下限から一致度がthresholdに届かないと分かるものだけ除く
+	indexes := []int{}
+	for i, n := range m.normalized {
+		if shared[i] || minSharedBigrams(len(t), len(n), threshold) <= 0 {
+			indexes = append(indexes, i)
+		}
+	}
+
+	ret := []NameCandidate{}
+	for _, i := range indexes {
+		if i == skip {
+			continue
+		}
+		n := m.normalized[i]
+		longer := max(len(n), len(t))
+		// 文字数の差だけで編集距離の下限が決まるので、届かないものは計算しない
+		if 1-float64(abs(len(n)-len(t)))/float64(longer) <= threshold {
+			continue
+		}
+		score := 1 - float64(EditDistance(t, n))/float64(longer)
+		if score > threshold {
+			ret = append(ret, NameCandidate{Index: i, Name: m.names[i], Score: score})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Score > ret[j].Score
+	})
+	return ret
+}
+
+// 長さaとbの文字列の一致度がthresholdを超えるとき、少なくとも共有する2文字の組の数
+// 編集1回で壊れる2文字の組は高々2つなので、編集距離kなら 長い方の組の数 - 2k 以上を共有する（q-gram lemma）
+func minSharedBigrams(a, b int, threshold float64) int {
+	longer := max(a, b)
+	// 一致度 1 - k / longer > threshold となる最大の編集距離（丸め誤差で大きめになっても絞り込みすぎない）
+	maxDist := int(math.Ceil((1-threshold)*float64(longer))) - 1
+	return longer - 1 - 2*maxDist
+}
+
+// 正規化した名前がtextを一部に含むものの添字を返す
+func (m *NameMatcher) Containing(text string) []int {
+	t := NormalizeName(text)
+	if t == "" {
+		return nil
+	}
+	ret := []int{}
+	for i, n := range m.normalized {
+		if strings.Contains(string(n), t) {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+func uniqueBigrams(r []rune) []string {
+	ret := []string{}
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(r); i++ {
+		bigram := string(r[i : i+2])
+		if !seen[bigram] {
+			seen[bigram] = true
+			ret = append(ret, bigram)
+		}
+	}
+	return ret
+}
+
+// 食材の一覧に対するNameMatcher
+// 日本語名に加えて、言語ごとの表記（ゲーム画面に表示される名前）でも照合する
+type FoodMatcher struct {
+	Foods []*Food
+	// NameMatcherの名前の添字ごとの食材
+	owners  []*Food
+	matcher *NameMatcher
+}
+
+// 画像の文字列の照合用（ゲーム画面に表示される名前だけで照合する）
+func NewFoodMatcher(foods []*Food) *FoodMatcher {
+	return newFoodMatcher(foods, false)
+}
+
+// 入力された食材名の照合用（別名でも照合する）
+func NewFoodMatcherWithAliases(foods []*Food) *FoodMatcher {
+	return newFoodMatcher(foods, true)
+}
+
+func newFoodMatcher(foods []*Food, aliases bool) *FoodMatcher {
+	names := []string{}
+	owners := []*Food{}
+	for _, food := range foods {
+		names = append(names, food.Name)
+		owners = append(owners, food)
+	}
+	// 日本語名どうしの照合の順位が変わらないよう、表記と別名は後ろに並べる
+	for _, food := range foods {
+		for _, name := range sortedLocalNames(food.Names) {
+			names = append(names, name)
+			owners = append(owners, food)
+		}
+		if !aliases {
+			continue
+		}
+		for _, alias := range food.Aliases {
+			names = append(names, alias)
+			owners = append(owners, food)
+		}
+	}
+	return &FoodMatcher{
+		Foods:   foods,
+		owners:  owners,
+		matcher: NewNameMatcher(names),
+	}
+}
+
+// 一致度がFoodMatchThresholdを超える食材を、一致度の高い順に返す（同じ食材は最も一致する名前の一致度にする）
+func (m *FoodMatcher) Candidates(text string) []FoodCandidate {
+	ret := []FoodCandidate{}
+	seen := make(map[*Food]bool)
+	for _, candidate := range m.matcher.Match(text, FoodMatchThreshold) {
+		food := m.owners[candidate.Index]
+		if seen[food] {
+			continue
+		}
+		seen[food] = true
+		ret = append(ret, FoodCandidate{Food: food, Score: candidate.Score})
+	}
+	return ret
+}
+
+// 入力された食材名（略称・部分一致を含む）を食材に解決する（解決できなければnil）
+// 複数の食材に一致するときも推測せずnilを返す
+func (m *FoodMatcher) Lookup(text string) *Food {
+	food, _ := m.Resolve(text)
+	return food
+}
+
+// 入力された食材名を食材に解決する
+// 完全一致、名前の一部として含む食材が1つだけ、あいまい一致の順に試す
+// 複数の食材に一致するとき（例: "ワカクサ", "とくせん"）は推測せず、一致した食材を2つ目の戻り値で返す
+func (m *FoodMatcher) Resolve(text string) (*Food, []*Food) {
+	candidates := m.Candidates(text)
+	if len(candidates) > 0 && candidates[0].Score == 1 {
+		return candidates[0].Food, nil
+	}
+	if len([]rune(NormalizeName(text))) >= 2 {
+		found := []*Food{}
+		for _, i := range m.matcher.Containing(text) {
+			if !containsFood(found, m.owners[i]) {
+				found = append(found, m.owners[i])
+			}
+		}
+		switch {
+		case len(found) == 1:
+			return found[0], nil
+		case len(found) > 1:
+			return nil, found
+		}
+	}
+	if len(candidates) > 1 && candidates[1].Score == candidates[0].Score {
+		found := []*Food{}
+		for _, candidate := range candidates {
+			if candidate.Score == candidates[0].Score {
+				found = append(found, candidate.Food)
+			}
+		}
+		return nil, found
+	}
+	if len(candidates) > 0 {
+		return candidates[0].Food, nil
+	}
+	return nil, nil
+}
+
+func containsFood(foods []*Food, food *Food) bool {
+	for _, f := range foods {
+		if f == food {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedLocalNames(names map[string]string) []string {
+	locales := []string{}
+	for locale := range names {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	ret := []string{}
+	for _, locale := range locales {
+		ret = append(ret, names[locale])
+	}
+	return ret
+}
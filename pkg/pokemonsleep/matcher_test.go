@@ -0,0 +1,117 @@
+package pokemonsleep
+
+import (
+	"testing"
+)
+
+func TestNormalizeName(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want string
+	}{
+		{in: "とくせんリンゴ", want: "トクセンリンゴ"},
+		{in: "ﾄｸｾﾝﾘﾝｺﾞ", want: "トクセンリンゴ"},
+		{in: "Fancy Apple", want: "fancyapple"},
+		{in: "ＦＡＮＣＹ　ＡＰＰＬＥ", want: "fancyapple"},
+		{in: "モ一モ一ミルク", want: "モーモーミルク"},
+		{in: "リラックス力カオ", want: "リラックスカカオ"},
+		{in: "ミ ル ク\n", want: "ミルク"},
+		{in: "", want: ""},
+	} {
+		if got := NormalizeName(tt.in); got != tt.want {
+			t.Errorf("NormalizeName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// 取り違えやすい文字は、どれも寄せる先の文字と同じ名前になる
+func TestNormalizeNameConfusables(t *testing.T) {
+	for from, to := range confusables {
+		if got, want := NormalizeName("ア"+string(from)+"イ"), NormalizeName("ア"+string(to)+"イ"); got != want {
+			t.Errorf("%q: got %q, want %q", from, got, want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{a: "", b: "", want: 0},
+		{a: "", b: "ミツ", want: 2},
+		{a: "アマイミツ", b: "アマイミツ", want: 0},
+		{a: "アマイミツ", b: "アマイミ", want: 1},
+		{a: "アマイミツ", b: "アマミツ", want: 1},
+		{a: "アマイミツ", b: "アXイYツ", want: 2},
+		{a: "kitten", b: "sitting", want: 3},
+	} {
+		if got := EditDistance([]rune(tt.a), []rune(tt.b)); got != tt.want {
+			t.Errorf("EditDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := EditDistance([]rune(tt.b), []rune(tt.a)); got != tt.want {
+			t.Errorf("EditDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+// 2文字の組を1つも共有しなくても、一致度がthresholdを超えるものは返す
+func TestNameMatcherMatchWithoutSharedBigrams(t *testing.T) {
+	matcher := NewNameMatcher([]string{"あまいミツ", "あんみんトマト", "マメミート"})
+	candidates := matcher.Match("アXイYツ", FoodMatchThreshold)
+	if len(candidates) == 0 || candidates[0].Name != "あまいミツ" {
+		t.Fatalf("Match(アXイYツ) = %v, want あまいミツ", candidates)
+	}
+	if candidates[0].Score != 0.6 {
+		t.Errorf("score = %v, want 0.6", candidates[0].Score)
+	}
+}
+
+// 索引で候補を絞っても、すべての名前と比べた場合と同じ結果になる
+func TestNameMatcherMatchesFullScan(t *testing.T) {
+	names := []string{}
+	for _, food := range newTestClient(t, NewReplayDetector(syntheticFixtureDir)).Foods {
+		names = append(names, food.Name)
+	}
+	matcher := NewNameMatcher(names)
+
+	inputs := []string{"X", "ミ", "ミツ", "アXイYツ", "トXセXリXゴ"}
+	for _, name := range names {
+		r := []rune(NormalizeName(name))
+		// 1文字おき・2文字おきに置き換えて、2文字の組が残らない入力も作る
+		for _, step := range []int{2, 3} {
+			mutated := append([]rune{}, r...)
+			for i := 1; i < len(mutated); i += step {
+				mutated[i] = 'X'
+			}
+			inputs = append(inputs, string(mutated))
+		}
+	}
+
+	for _, input := range inputs {
+		for _, threshold := range []float64{0.3, FoodMatchThreshold, 0.7} {
+			want := map[int]float64{}
+			r := []rune(NormalizeName(input))
+			for i, name := range names {
+				n := []rune(NormalizeName(name))
+				score := 1 - float64(EditDistance(r, n))/float64(max(len(r), len(n)))
+				if score > threshold {
+					want[i] = score
+				}
+			}
+			got := map[int]float64{}
+			for _, candidate := range matcher.Match(input, threshold) {
+				got[candidate.Index] = candidate.Score
+			}
+			if len(got) != len(want) {
+				t.Errorf("Match(%q, %v) = %v, want %v", input, threshold, got, want)
+				continue
+			}
+			for i, score := range want {
+				if got[i] != score {
+					t.Errorf("Match(%q, %v): %s got %v, want %v", input, threshold, names[i], got[i], score)
+				}
+			}
+		}
+	}
+}
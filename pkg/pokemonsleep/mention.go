@@ -0,0 +1,184 @@
+package pokemonsleep
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var levelPattern = regexp.MustCompile(`(?i)(?:lv|level|レベル)[\s　.]*[:：=＝]?[\s　]*([0-9]+)`)
+var incomePattern = regexp.MustCompile(`([^\s　0-9xX×]+)[\s　]*[xX×]?[\s　]*([0-9]+)`)
+var editPattern = regexp.MustCompile(`([^\s　0-9+＋\-−=＝<>@]+)[\s　]*([+＋\-−=＝])[\s　]*([0-9]+)`)
+var potPattern = regexp.MustCompile(`(?i)(?:鍋|なべ|ナベ|\bpot)[\s　]*[:：=＝]?[\s　]*([0-9]+)`)
+
+// 本文にキーワードのいずれかが含まれるか
+// 英語のキーワードは単語として含まれるときだけ一致とする（"explain"の"plan"や"Stewart"の"stew"を拾わない）
+func HasKeyword(text string, keywords ...string) bool {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	})
+	for _, keyword := range keywords {
+		if isASCII(keyword) {
+			if In(strings.ToLower(keyword), words) {
+				return true
+			}
+		} else if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func isASCII(text string) bool {
+	for _, r := range text {
+		if r >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// 全角数字を半角に揃える
+func normalizeDigits(text string) string {
+	return strings.Map(func(r rune) rune {
+		if '０' <= r && r <= '９' {
+			return r - '０' + '0'
+		}
+		return r
+	}, text)
+}
+
+// メンション本文から鍋の容量（例: "鍋 30"）を読み取る
+func ParsePotCapacity(text string) (int, bool) {
+	m := potPattern.FindStringSubmatch(normalizeDigits(text))
+	if m == nil {
+		return 0, false
+	}
+	pot, err := strconv.Atoi(m[1])
+	if err != nil || pot <= 0 {
+		return 0, false
+	}
+	return pot, true
+}
+
+// メンション本文からレシピレベル（例: "Lv 10"）を読み取る
+func ParseRecipeLevel(text string) (int, bool) {
+	m := levelPattern.FindStringSubmatch(normalizeDigits(text))
+	if m == nil {
+		return 0, false
+	}
+	level, err := strconv.Atoi(m[1])
+	if err != nil || level <= 0 {
+		return 0, false
+	}
+	return level, true
+}
+
+// メンション本文の"毎日"（または"収入"、"daily"）以降から、1日あたりの食材の増加量（例: "毎日 リンゴ 10 トマト 5"）を読み取る
+// 食材名はmatcher（NewFoodMatcherWithAliasesで作った入力用の索引）で解決する
+func ParseDailyIncome(text string, matcher *FoodMatcher) map[string]int {
+	ret := make(map[string]int)
+	text = normalizeDigits(text)
+	lower := strings.ToLower(text)
+	start := -1
+	for _, keyword := range []string{"毎日", "収入", "daily", "income"} {
+		if i := strings.Index(lower, keyword); i >= 0 && (start < 0 || i < start) {
+			start = i + len(keyword)
+		}
+	}
+	if start < 0 {
+		return ret
+	}
+
+	for _, m := range incomePattern.FindAllStringSubmatch(text[start:], -1) {
+		num, err := strconv.Atoi(m[2])
+		if err != nil {
+			continue
+		}
+		if food := matcher.Lookup(m[1]); food != nil {
+			ret[food.Name] += num
+		}
+	}
+	return ret
+}
+
+// 在庫の修正以外の指示（献立・毎日の収入・在庫の表示・デバッグ）のキーワード
+var commandKeywords = []string{"献立", "plan", "毎日", "収入", "daily", "income", "在庫", "inventory", "デバッグ", "debug"}
+
+// メンション本文を在庫の修正として扱うか
+// 他の指示のキーワードがあれば、"献立 毎日 リンゴ=10"のような本文で在庫を書き換えないよう修正としない
+func IsInventoryEdit(text string) bool {
+	return !HasKeyword(text, commandKeywords...)
+}
+
+// 在庫の手修正（例: "リンゴ +3", "トマト=12", "シッポ -1"）
+type InventoryEdit struct {
+	Food *Food
+	// '+'（増やす）, '-'（減らす）, '='（上書き）のいずれか
+	Op  rune
+	Num int
+}
+
+// 修正の対象ではない語（鍋の容量やレシピレベルの指定）
+var editIgnoredWords = []string{"鍋", "なべ", "ナベ", "pot", "lv", "level", "レベル", "lang", "言語"}
+
+// メンション本文から在庫の修正を読み取る
+// 食材名はmatcher（NewFoodMatcherWithAliasesで作った入力用の索引）で解決する
+// 食材に解決できなかった名前は2つ目の戻り値で、複数の食材に一致した名前は3つ目の戻り値で返す
+func ParseInventoryEdits(text string, matcher *FoodMatcher) ([]InventoryEdit, []string, []string) {
+	edits := []InventoryEdit{}
+	unknowns := []string{}
+	ambiguous := []string{}
+	for _, m := range editPattern.FindAllStringSubmatch(normalizeDigits(text), -1) {
+		num, err := strconv.Atoi(m[3])
+		if err != nil {
+			continue
+		}
+		var op rune
+		switch m[2] {
+		case "+", "＋":
+			op = '+'
+		case "-", "−":
+			op = '-'
+		default:
+			op = '='
+		}
+		// "pot=30"の"pot"が"Soft Potato"に部分一致しないよう、食材名より先に除く
+		if In(strings.ToLower(m[1]), editIgnoredWords) {
+			continue
+		}
+		food, matched := matcher.Resolve(m[1])
+		if len(matched) > 0 {
+			ambiguous = append(ambiguous, m[1])
+			continue
+		}
+		if food == nil {
+			unknowns = append(unknowns, m[1])
+			continue
+		}
+		edits = append(edits, InventoryEdit{Food: food, Op: op, Num: num})
+	}
+	return edits, unknowns, ambiguous
+}
+
+// 在庫に修正を適用した新しい在庫を返す（0未満にはしない）
+func ApplyInventoryEdits(foods map[string]int, edits []InventoryEdit) map[string]int {
+	ret := make(map[string]int)
+	for name, num := range foods {
+		ret[name] = num
+	}
+	for _, edit := range edits {
+		switch edit.Op {
+		case '+':
+			ret[edit.Food.Name] += edit.Num
+		case '-':
+			ret[edit.Food.Name] -= edit.Num
+		default:
+			ret[edit.Food.Name] = edit.Num
+		}
+		if ret[edit.Food.Name] <= 0 {
+			delete(ret, edit.Food.Name)
+		}
+	}
+	return ret
+}
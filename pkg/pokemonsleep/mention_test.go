@@ -0,0 +1,108 @@
+package pokemonsleep
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 在庫の修正の食材名は、複数の食材に一致すれば推測しない
+func TestParseInventoryEdits(t *testing.T) {
+	matcher := newTestClient(t, NewReplayDetector(syntheticFixtureDir)).InputMatcher
+	for _, tt := range []struct {
+		text      string
+		edits     []string
+		unknowns  []string
+		ambiguous []string
+	}{
+		{text: "リンゴ +3", edits: []string{"とくせんリンゴ"}},
+		{text: "トマト=12 シッポ -1", edits: []string{"あんみんトマト", "おいしいシッポ"}},
+		{text: "Fancy Apple +2", edits: []string{"とくせんリンゴ"}},
+		{text: "ワカクサ +3", ambiguous: []string{"ワカクサ"}},
+		{text: "とくせん=5 ミルク+1", edits: []string{"モーモーミルク"}, ambiguous: []string{"とくせん"}},
+		{text: "ほげほげ +1", unknowns: []string{"ほげほげ"}},
+		{text: "鍋=30 リンゴ+1", edits: []string{"とくせんリンゴ"}},
+	} {
+		t.Run(tt.text, func(t *testing.T) {
+			edits, unknowns, ambiguous := ParseInventoryEdits(tt.text, matcher)
+			names := []string{}
+			for _, edit := range edits {
+				names = append(names, edit.Food.Name)
+			}
+			if want := append([]string{}, tt.edits...); !reflect.DeepEqual(names, want) {
+				t.Errorf("edits = %v, want %v", names, want)
+			}
+			if want := append([]string{}, tt.unknowns...); !reflect.DeepEqual(unknowns, want) {
+				t.Errorf("unknowns = %v, want %v", unknowns, want)
+			}
+			if want := append([]string{}, tt.ambiguous...); !reflect.DeepEqual(ambiguous, want) {
+				t.Errorf("ambiguous = %v, want %v", ambiguous, want)
+			}
+		})
+	}
+}
+
+// 英語のキーワードは単語として含まれるときだけ一致する
+func TestHasKeyword(t *testing.T) {
+	for _, tt := range []struct {
+		text     string
+		keywords []string
+		want     bool
+	}{
+		{text: "今週の献立", keywords: []string{"献立", "plan"}, want: true},
+		{text: "make a plan lv30", keywords: []string{"献立", "plan"}, want: true},
+		{text: "Plan!", keywords: []string{"plan"}, want: true},
+		{text: "explain this", keywords: []string{"献立", "plan"}, want: false},
+		{text: "planet", keywords: []string{"plan"}, want: false},
+		{text: "debugging", keywords: []string{"debug"}, want: false},
+		{text: "在庫を見せて", keywords: []string{"在庫", "inventory"}, want: true},
+		{text: "inventory-check", keywords: []string{"inventory"}, want: true},
+		{text: "Stewart's curry", keywords: []string{"stew"}, want: false},
+		{text: "<@U1>curry", keywords: []string{"curry"}, want: true},
+	} {
+		if got := HasKeyword(tt.text, tt.keywords...); got != tt.want {
+			t.Errorf("HasKeyword(%q, %q) = %v, want %v", tt.text, tt.keywords, got, tt.want)
+		}
+	}
+}
+
+// レシピのカテゴリは単語として指定されたときだけ選ぶ
+func TestCategoryCooks(t *testing.T) {
+	client := newTestClient(t, NewReplayDetector(syntheticFixtureDir))
+	for _, tt := range []struct {
+		text string
+		want string
+	}{
+		{text: "カレー 鍋30", want: "カレー"},
+		{text: "curry pot 30", want: "カレー"},
+		{text: "Stews please", want: "カレー"},
+		{text: "Stewart", want: ""},
+		{text: "drinks", want: "デザート"},
+		{text: "drinking", want: ""},
+		{text: "salad", want: "サラダ"},
+		{text: "saladbar", want: ""},
+	} {
+		if got, _ := client.CategoryCooks(tt.text); got != tt.want {
+			t.Errorf("CategoryCooks(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+// 献立などの指示に添えた食材と個数は、在庫の修正として扱わない
+func TestIsInventoryEdit(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want bool
+	}{
+		{text: "リンゴ +3", want: true},
+		{text: "<@U1> トマト=12 シッポ -1", want: true},
+		{text: "Fancy Apple +2 lang en", want: true},
+		{text: "献立 カレー 毎日 リンゴ=10", want: false},
+		{text: "plan curry daily apple=10", want: false},
+		{text: "在庫 リンゴ+1", want: false},
+		{text: "デバッグ リンゴ=3", want: false},
+	} {
+		if got := IsInventoryEdit(tt.text); got != tt.want {
+			t.Errorf("IsInventoryEdit(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package pokemonsleep
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// 複数のスクリーンショットから検出した食材をまとめる
+// バッグをスクロールして撮ると同じ食材が複数の画像に写るが、個数は同じ在庫を指しているので足し合わせない
+// 画像によって個数が食い違うときは、行が見切れて桁が欠けている可能性が高いので大きい方を採る
+func MergeDetectedFoods(logger *zap.Logger, results ...map[string]int) map[string]int {
+	ret := make(map[string]int)
+	for _, result := range results {
+		for name, num := range result {
+			prev, ok := ret[name]
+			if ok && prev != num && logger != nil {
+				logger.Warn("detected food count conflicts between images.", zap.String("food", name), zap.Int("prev", prev), zap.Int("num", num))
+			}
+			if !ok || prev < num {
+				ret[name] = num
+			}
+		}
+	}
+	return ret
+}
+
+// 画像を並行してダウンロードする
+func (c *Client) DownloadImages(files []ImageFile) ([]*Image, error) {
+	imgs := make([]*Image, len(files))
+	errs := make([]error, len(files))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		wg.Add(1)
+		go func(i int, file ImageFile) {
+			defer wg.Done()
+			imgs[i], errs[i] = c.DownloadImage(file.URL, file.Filetype, file.Width, file.Height)
+		}(i, file)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+	}
+	return imgs, nil
+}
+
+// 画像を並行してOCRし、検出した食材をまとめる
+func (c *Client) DetectFoodsAll(ctx context.Context, imgs []*Image) (map[string]int, error) {
+	dresults, err := c.DetectResults(ctx, imgs)
+	if err != nil {
+		return nil, err
+	}
+	return MergeDetectResults(c.Logger, dresults), nil
+}
+
+// 画像を並行してOCRし、画像ごとの検出結果を返す
+func (c *Client) DetectResults(ctx context.Context, imgs []*Image) ([]*DetectResult, error) {
+	dresults := make([]*DetectResult, len(imgs))
+	errs := make([]error, len(imgs))
+	var wg sync.WaitGroup
+	for i, img := range imgs {
+		wg.Add(1)
+		go func(i int, img *Image) {
+			defer wg.Done()
+			dresults[i], errs[i] = c.DetectFoods(ctx, img)
+		}(i, img)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+	}
+	return dresults, nil
+}
+
+func MergeDetectResults(logger *zap.Logger, dresults []*DetectResult) map[string]int {
+	results := []map[string]int{}
+	for _, dres := range dresults {
+		results = append(results, dres.DetectedFoods)
+	}
+	return MergeDetectedFoods(logger, results...)
+}
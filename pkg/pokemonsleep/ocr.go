@@ -0,0 +1,269 @@
+package pokemonsleep
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	vision "cloud.google.com/go/vision/apiv1"
+	"cloud.google.com/go/vision/v2/apiv1/visionpb"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// OCRで検出された文字列と、その外接矩形（ピクセル座標）
+type TextBox struct {
+	Text string `json:"text"`
+
+	MinX int `json:"min_x"`
+	MinY int `json:"min_y"`
+	MaxX int `json:"max_x"`
+	MaxY int `json:"max_y"`
+}
+
+// 画像から文字列を検出するOCRバックエンド
+// 先頭の要素は画像全体の文字列、以降は単語ごとの文字列とする（Vision APIと同じ並び）
+type TextDetector interface {
+	DetectTexts(ctx context.Context, r io.Reader) ([]TextBox, error)
+	Close() error
+}
+
+// Google Cloud Vision APIによるTextDetector
+type VisionDetector struct {
+	Vision *vision.ImageAnnotatorClient
+}
+
+func NewVisionDetector(ctx context.Context) (*VisionDetector, error) {
+	vc, err := vision.NewImageAnnotatorClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("init vision client failed: %w", err)
+	}
+	return &VisionDetector{Vision: vc}, nil
+}
+
+func (v *VisionDetector) DetectTexts(ctx context.Context, r io.Reader) ([]TextBox, error) {
+	// Vision AIに読み込ませる準備
+	visionImg, err := vision.NewImageFromReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("load file failed: %w", err)
+	}
+
+	// 実行
+	annotations, err := v.Vision.DetectTexts(ctx, visionImg, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("execute ocr failed: %w", err)
+	}
+	return NewTextBoxes(annotations), nil
+}
+
+func (v *VisionDetector) Close() error {
+	return v.Vision.Close()
+}
+
+// 記録済みのOCR結果をディスクから読み込むTextDetector
+// 画像に名前（NewNamedReader）があれば <名前>.json（Fixture）を、なければ画像のSHA-256（<hash>.json）を Dir 以下から探す
+type ReplayDetector struct {
+	Dir string
+}
+
+func NewReplayDetector(dir string) *ReplayDetector {
+	return &ReplayDetector{Dir: dir}
+}
+
+func (d *ReplayDetector) DetectTexts(ctx context.Context, r io.Reader) ([]TextBox, error) {
+	if named, ok := r.(interface{ Name() string }); ok {
+		annotationsPath, _ := FixturePaths(d.Dir, FixtureName(named.Name()))
+		if _, err := os.Stat(annotationsPath); err == nil {
+			return d.load(annotationsPath)
+		}
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read image failed: %w", err)
+	}
+	return d.load(filepath.Join(d.Dir, AnnotationFileName(data)))
+}
+
+func (d *ReplayDetector) load(path string) ([]TextBox, error) {
+	annotations, err := LoadAnnotations(path)
+	if err != nil {
+		return nil, fmt.Errorf("load annotations (%s) failed: %w", path, err)
+	}
+	return NewTextBoxes(annotations), nil
+}
+
+func (d *ReplayDetector) Close() error {
+	return nil
+}
+
+// 別のTextDetectorの結果を Dir 以下に記録するTextDetector
+// 記録したファイルはReplayDetectorでそのまま再生できる
+type RecordingDetector struct {
+	Detector TextDetector
+	Dir      string
+}
+
+func NewRecordingDetector(detector TextDetector, dir string) *RecordingDetector {
+	return &RecordingDetector{Detector: detector, Dir: dir}
+}
+
+func (d *RecordingDetector) DetectTexts(ctx context.Context, r io.Reader) ([]TextBox, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read image failed: %w", err)
+	}
+	boxes, err := d.Detector.DetectTexts(ctx, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(d.Dir, AnnotationFileName(data))
+	if err := SaveAnnotations(path, NewAnnotations(boxes)); err != nil {
+		return nil, fmt.Errorf("save annotations (%s) failed: %w", path, err)
+	}
+	return boxes, nil
+}
+
+func (d *RecordingDetector) Close() error {
+	return d.Detector.Close()
+}
+
+// 名前（画像ファイルのパスやFixture名）のついた画像のバイト列
+type namedReader struct {
+	io.Reader
+	name string
+}
+
+func NewNamedReader(name string, r io.Reader) io.Reader {
+	return &namedReader{Reader: r, name: name}
+}
+
+func (r *namedReader) Name() string {
+	return r.name
+}
+
+// Seekできる画像（DecodeImageで作ったもの）は、名前をつけてもアイコン照合などで読み直せるようにする
+func (r *namedReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.Reader.(io.Seeker)
+	if !ok {
+		return 0, fmt.Errorf("%s is not seekable", r.name)
+	}
+	return seeker.Seek(offset, whence)
+}
+
+func AnnotationFileName(image []byte) string {
+	sum := sha256.Sum256(image)
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+func NewTextBox(a *visionpb.EntityAnnotation) TextBox {
+	var x1, x2, y1, y2 = math.MaxInt32, 0, math.MaxInt32, 0
+	for _, vertex := range a.GetBoundingPoly().GetVertices() {
+		x1 = int(math.Min(float64(x1), float64(vertex.GetX())))
+		x2 = int(math.Max(float64(x2), float64(vertex.GetX())))
+		y1 = int(math.Min(float64(y1), float64(vertex.GetY())))
+		y2 = int(math.Max(float64(y2), float64(vertex.GetY())))
+	}
+	if x1 > x2 {
+		x1 = x2
+	}
+	if y1 > y2 {
+		y1 = y2
+	}
+	return TextBox{
+		Text: a.GetDescription(),
+		MinX: x1,
+		MinY: y1,
+		MaxX: x2,
+		MaxY: y2,
+	}
+}
+
+func NewTextBoxes(annotations []*visionpb.EntityAnnotation) []TextBox {
+	boxes := make([]TextBox, 0, len(annotations))
+	for _, a := range annotations {
+		boxes = append(boxes, NewTextBox(a))
+	}
+	return boxes
+}
+
+func NewAnnotation(b TextBox) *visionpb.EntityAnnotation {
+	return &visionpb.EntityAnnotation{
+		Description: b.Text,
+		BoundingPoly: &visionpb.BoundingPoly{
+			Vertices: []*visionpb.Vertex{
+				{X: int32(b.MinX), Y: int32(b.MinY)},
+				{X: int32(b.MaxX), Y: int32(b.MinY)},
+				{X: int32(b.MaxX), Y: int32(b.MaxY)},
+				{X: int32(b.MinX), Y: int32(b.MaxY)},
+			},
+		},
+	}
+}
+
+func NewAnnotations(boxes []TextBox) []*visionpb.EntityAnnotation {
+	annotations := make([]*visionpb.EntityAnnotation, 0, len(boxes))
+	for _, b := range boxes {
+		annotations = append(annotations, NewAnnotation(b))
+	}
+	return annotations
+}
+
+// visionpb.EntityAnnotationのJSON配列を読み込む
+func LoadAnnotations(path string) ([]*visionpb.EntityAnnotation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file failed: %w", err)
+	}
+	return UnmarshalAnnotations(data)
+}
+
+func UnmarshalAnnotations(data []byte) ([]*visionpb.EntityAnnotation, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, fmt.Errorf("json unmarshal failed: %w", err)
+	}
+	annotations := make([]*visionpb.EntityAnnotation, 0, len(raws))
+	for _, raw := range raws {
+		a := &visionpb.EntityAnnotation{}
+		if err := protojson.Unmarshal(raw, a); err != nil {
+			return nil, fmt.Errorf("protojson unmarshal failed: %w", err)
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, nil
+}
+
+// visionpb.EntityAnnotationをJSON配列として書き出す
+func SaveAnnotations(path string, annotations []*visionpb.EntityAnnotation) error {
+	data, err := MarshalAnnotations(annotations)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write file failed: %w", err)
+	}
+	return nil
+}
+
+func MarshalAnnotations(annotations []*visionpb.EntityAnnotation) ([]byte, error) {
+	raws := make([]json.RawMessage, 0, len(annotations))
+	for _, a := range annotations {
+		raw, err := protojson.Marshal(a)
+		if err != nil {
+			return nil, fmt.Errorf("protojson marshal failed: %w", err)
+		}
+		raws = append(raws, raw)
+	}
+	data, err := json.MarshalIndent(raws, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("json marshal failed: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,180 @@
+package pokemonsleep
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+)
+
+var (
+	rawTextColor = color.RGBA{R: 160, G: 160, B: 160, A: 255}
+	gridColor    = color.RGBA{R: 0, G: 200, B: 0, A: 255}
+	matchColor   = color.RGBA{R: 255, G: 0, B: 0, A: 255}
+	labelColor   = color.RGBA{R: 255, G: 255, B: 255, A: 255}
+
+	// クラスタごとに順に使う色
+	clusterColors = []color.RGBA{
+		{R: 0, G: 114, B: 178, A: 255},
+		{R: 230, G: 159, B: 0, A: 255},
+		{R: 0, G: 158, B: 115, A: 255},
+		{R: 204, G: 121, B: 167, A: 255},
+		{R: 86, G: 180, B: 233, A: 255},
+		{R: 213, G: 94, B: 0, A: 255},
+		{R: 240, G: 228, B: 66, A: 255},
+	}
+)
+
+// OCRの枠、DBSCANでまとめた枠、マス目、食材名と個数の対応を画像に描く
+// 日本語のフォントは持たないので、食材には番号だけを振り、名前はOverlayLegendで添える
+func (d *DetectResult) DrawOverlay() (*image.RGBA, error) {
+	src, err := d.Image.Decode()
+	if err != nil {
+		return nil, err
+	}
+	canvas := image.NewRGBA(src.Bounds())
+	draw.Draw(canvas, canvas.Bounds(), src, src.Bounds().Min, draw.Src)
+
+	scale := canvas.Bounds().Dx() / 400
+	if scale < 2 {
+		scale = 2
+	}
+
+	if d.Grid != nil {
+		d.Grid.Draw(canvas, gridColor)
+	}
+	for _, dtext := range d.RawTexts {
+		dtext.DrawRect(canvas, rawTextColor, 1)
+	}
+	for i, cluster := range d.Clusters {
+		c := clusterColors[i%len(clusterColors)]
+		for _, dtext := range cluster {
+			dtext.DrawRect(canvas, c, 1)
+		}
+		if i < len(d.DetectedTexts) && len(cluster) > 1 {
+			d.DetectedTexts[i].DrawRect(canvas, c, 2)
+		}
+	}
+	for i, match := range d.Matches {
+		label := "#" + strconv.Itoa(i+1)
+		match.Text.DrawRect(canvas, matchColor, 3)
+		drawLabel(canvas, match.Text.MinX, match.Text.MinY-3-glyphHeight*scale, label, scale)
+		if match.NumText != nil && match.NumText != match.Text {
+			match.NumText.DrawRect(canvas, matchColor, 3)
+			drawLine(canvas, center(match.Text), center(match.NumText), matchColor)
+			drawLabel(canvas, match.NumText.MinX, match.NumText.MaxY+4, label+"x"+strconv.Itoa(match.Num), scale)
+		}
+	}
+	return canvas, nil
+}
+
+func (d *DetectResult) OverlayPNG() ([]byte, error) {
+	canvas, err := d.DrawOverlay()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, fmt.Errorf("encode png failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DrawOverlayで振った番号と、読み取った文字列の対応
+func (d *DetectResult) OverlayLegend() string {
+	var ret string
+	for i, match := range d.Matches {
+		numText := "-"
+		if match.NumText != nil {
+			numText = match.NumText.Joined()
+		}
+		ret += "#" + strconv.Itoa(i+1) + " " + match.Food.Name + " x" + strconv.Itoa(match.Num) +
+			" ← 「" + match.Text.Joined() + "」「" + numText + "」" +
+			" (" + strconv.FormatFloat(match.Confidence, 'f', 2, 64) + ")\n"
+	}
+	ret += "OCR " + strconv.Itoa(len(d.RawTexts)) + "件 → クラスタ " + strconv.Itoa(len(d.Clusters)) + "件\n"
+	return ret
+}
+
+func center(d *DetectedText) image.Point {
+	return image.Pt((d.MinX+d.MaxX)/2, (d.MinY+d.MaxY)/2)
+}
+
+func drawLine(canvas *image.RGBA, from, to image.Point, c color.Color) {
+	dx, dy := abs(to.X-from.X), -abs(to.Y-from.Y)
+	sx, sy := 1, 1
+	if from.X > to.X {
+		sx = -1
+	}
+	if from.Y > to.Y {
+		sy = -1
+	}
+	err := dx + dy
+	for p := from; ; {
+		canvas.Set(p.X, p.Y, c)
+		if p == to {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			p.X += sx
+		} else {
+			err += dx
+			p.Y += sy
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+// ラベル用の3x5のビットマップフォント（各行の下位3ビットを左から描く）
+var glyphs = map[rune][glyphHeight]uint8{
+	'0': {7, 5, 5, 5, 7},
+	'1': {2, 6, 2, 2, 7},
+	'2': {7, 1, 7, 4, 7},
+	'3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1},
+	'5': {7, 4, 7, 1, 7},
+	'6': {7, 4, 7, 5, 7},
+	'7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7},
+	'9': {7, 5, 7, 1, 7},
+	'x': {0, 5, 2, 5, 0},
+	'#': {5, 7, 5, 7, 5},
+}
+
+// 背景を塗りつぶしてから文字を描く
+func drawLabel(canvas *image.RGBA, x, y int, text string, scale int) {
+	width := (len(text)*(glyphWidth+1) + 1) * scale
+	height := (glyphHeight + 2) * scale
+	bg := image.Rect(x, y, x+width, y+height).Intersect(canvas.Bounds())
+	draw.Draw(canvas, bg, image.NewUniform(matchColor), image.Point{}, draw.Src)
+
+	cx := x + scale
+	for _, r := range text {
+		glyph := glyphs[r]
+		for row, bits := range glyph {
+			for col := 0; col < glyphWidth; col++ {
+				if bits&(1<<(glyphWidth-1-col)) == 0 {
+					continue
+				}
+				px := image.Rect(cx+col*scale, y+(row+1)*scale, cx+(col+1)*scale, y+(row+2)*scale)
+				draw.Draw(canvas, px.Intersect(canvas.Bounds()), image.NewUniform(labelColor), image.Point{}, draw.Src)
+			}
+		}
+		cx += (glyphWidth + 1) * scale
+	}
+}
@@ -0,0 +1,262 @@
+package pokemonsleep
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	MealsPerDay  = 3
+	DaysPerWeek  = 7
+	MealsPerWeek = MealsPerDay * DaysPerWeek
+
+	// ビームサーチで残す状態数
+	DefaultPlanBeamWidth = 256
+)
+
+var (
+	weekdayNames = []string{"月", "火", "水", "木", "金", "土", "日"}
+	mealNames    = []string{"朝", "昼", "夜"}
+)
+
+// 献立の条件
+type PlanRequest struct {
+	Foods []*Food
+	Cooks []*Cook
+
+	// 手持ちの食材と、毎日の食材の増加量（朝食前に加わるものとする）
+	Inventory   map[string]int
+	DailyIncome map[string]int
+
+	Pot   int
+	Level int
+
+	BeamWidth int
+}
+
+// 1回分の食事
+// Cookがnilのときは料理を作らずに食材を温存する
+type PlannedMeal struct {
+	Day  int
+	Meal int
+
+	Cook   *Cook
+	Filler map[string]int
+	Energy int
+}
+
+func (m *PlannedMeal) Label() string {
+	return weekdayNames[m.Day] + " " + mealNames[m.Meal]
+}
+
+type Plan struct {
+	Meals       []*PlannedMeal
+	TotalEnergy int
+	Leftover    map[string]int
+}
+
+// ビームサーチの状態
+type planState struct {
+	inventory []int
+	energy    int
+	meals     []*PlannedMeal
+}
+
+func (s *planState) key() string {
+	var b strings.Builder
+	for _, n := range s.inventory {
+		b.WriteString(strconv.Itoa(n))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// 1週間（21食）の献立を、合計エナジーが最大になるよう探索する
+// 食材の在庫を状態としたビームサーチで、各食事では「作らない」「レシピ通り」「レシピ+鍋の空きを追加食材で埋める」を候補とする
+func MakePlan(req PlanRequest) *Plan {
+	width := req.BeamWidth
+	if width <= 0 {
+		width = DefaultPlanBeamWidth
+	}
+
+	index := make(map[string]int)
+	for i, food := range req.Foods {
+		index[food.Name] = i
+	}
+	toVector := func(m map[string]int) []int {
+		v := make([]int, len(req.Foods))
+		for name, num := range m {
+			if i, ok := index[name]; ok {
+				v[i] = num
+			}
+		}
+		return v
+	}
+	income := toVector(req.DailyIncome)
+
+	// 鍋に入りきらないレシピや、未知の食材を使うレシピは候補から外す
+	cooks := []*Cook{}
+	for _, cook := range req.Cooks {
+		if !fitsPot(cook, req.Pot) {
+			continue
+		}
+		known := true
+		for _, food := range cook.Recipe {
+			if _, ok := index[food.Name]; !ok {
+				known = false
+			}
+		}
+		if known {
+			cooks = append(cooks, cook)
+		}
+	}
+
+	beam := []*planState{{inventory: toVector(req.Inventory)}}
+	for t := 0; t < MealsPerWeek; t++ {
+		day, meal := t/MealsPerDay, t%MealsPerDay
+
+		candidates := make(map[string]*planState)
+		push := func(s *planState) {
+			k := s.key()
+			if prev, ok := candidates[k]; !ok || prev.energy < s.energy {
+				candidates[k] = s
+			}
+		}
+
+		for _, state := range beam {
+			inventory := append([]int{}, state.inventory...)
+			if meal == 0 {
+				for i, n := range income {
+					inventory[i] += n
+				}
+			}
+
+			push(state.next(inventory, &PlannedMeal{Day: day, Meal: meal}, 0))
+
+			for _, cook := range cooks {
+				left := append([]int{}, inventory...)
+				makable := true
+				for _, food := range cook.Recipe {
+					left[index[food.Name]] -= food.Num
+					if left[index[food.Name]] < 0 {
+						makable = false
+					}
+				}
+				if !makable {
+					continue
+				}
+				energy := cook.LeveledEnergy(req.Foods, req.Level)
+				push(state.next(left, &PlannedMeal{Day: day, Meal: meal, Cook: cook, Energy: energy}, energy))
+
+				filled, filler, fillerEnergy := fillPot(left, req.Foods, req.Pot-cook.TotalIngredients())
+				if fillerEnergy > 0 {
+					push(state.next(filled, &PlannedMeal{Day: day, Meal: meal, Cook: cook, Filler: filler, Energy: energy + fillerEnergy}, energy+fillerEnergy))
+				}
+			}
+		}
+
+		beam = beam[:0]
+		for _, s := range candidates {
+			beam = append(beam, s)
+		}
+		sort.Slice(beam, func(i, j int) bool {
+			if beam[i].energy != beam[j].energy {
+				return beam[i].energy > beam[j].energy
+			}
+			return beam[i].key() < beam[j].key()
+		})
+		if len(beam) > width {
+			beam = beam[:width]
+		}
+	}
+
+	best := beam[0]
+	leftover := make(map[string]int)
+	for i, n := range best.inventory {
+		if n > 0 {
+			leftover[req.Foods[i].Name] = n
+		}
+	}
+	return &Plan{
+		Meals:       best.meals,
+		TotalEnergy: best.energy,
+		Leftover:    leftover,
+	}
+}
+
+func (s *planState) next(inventory []int, meal *PlannedMeal, energy int) *planState {
+	meals := make([]*PlannedMeal, len(s.meals), len(s.meals)+1)
+	copy(meals, s.meals)
+	return &planState{
+		inventory: inventory,
+		energy:    s.energy + energy,
+		meals:     append(meals, meal),
+	}
+}
+
+// 鍋の空きをエナジーの高い食材から埋める
+func fillPot(inventory []int, foods []*Food, space int) ([]int, map[string]int, int) {
+	if space <= 0 {
+		return inventory, nil, 0
+	}
+	order := make([]int, len(foods))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return foods[order[a]].Energy > foods[order[b]].Energy
+	})
+
+	left := append([]int{}, inventory...)
+	filler := make(map[string]int)
+	energy := 0
+	for _, i := range order {
+		if space == 0 {
+			break
+		}
+		n := left[i]
+		if n <= 0 {
+			continue
+		}
+		if n > space {
+			n = space
+		}
+		left[i] -= n
+		space -= n
+		filler[foods[i].Name] = n
+		energy += foods[i].Energy * n
+	}
+	return left, filler, energy
+}
+
+func (p *Plan) String() string {
+	return p.Format(NewTranslator(DefaultLocale, nil))
+}
+
+// 献立を文字列にする（曜日や料理名などはtrの言語にする）
+func (p *Plan) Format(tr *Translator) string {
+	var ret string
+	for _, meal := range p.Meals {
+		label := tr.Msg(weekdayNames[meal.Day]) + " " + tr.Msg(mealNames[meal.Meal])
+		if meal.Cook == nil {
+			ret += "    " + tr.Msg("%s: (作らずに食材を温存)", label) + "\n"
+			continue
+		}
+		ret += "    " + label + ": " + tr.Msg("%s (%dエナジー)", tr.Name(meal.Cook.Name), meal.Energy) + "\n"
+		if len(meal.Filler) > 0 {
+			names := []string{}
+			for name := range meal.Filler {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fillers := []string{}
+			for _, name := range names {
+				fillers = append(fillers, tr.Name(name)+" x"+strconv.Itoa(meal.Filler[name]))
+			}
+			ret += "          ＋ " + strings.Join(fillers, ", ") + "\n"
+		}
+	}
+	ret += tr.Msg("合計: %dエナジー", p.TotalEnergy) + "\n"
+	return ret
+}
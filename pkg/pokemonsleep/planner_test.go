@@ -0,0 +1,189 @@
+package pokemonsleep
+
+import (
+	"reflect"
+	"testing"
+)
+
+// 献立を頭から食材を減らしながらたどり、足りない食材を使っていないことと合計エナジーを確かめる
+func checkPlan(t *testing.T, req PlanRequest, plan *Plan) {
+	t.Helper()
+	if len(plan.Meals) != MealsPerWeek {
+		t.Fatalf("len(Meals) = %d, want %d", len(plan.Meals), MealsPerWeek)
+	}
+
+	inventory := make(map[string]int)
+	for name, num := range req.Inventory {
+		inventory[name] = num
+	}
+	total := 0
+	for i, meal := range plan.Meals {
+		if meal.Day != i/MealsPerDay || meal.Meal != i%MealsPerDay {
+			t.Fatalf("meal %d is %s", i, meal.Label())
+		}
+		if meal.Meal == 0 {
+			for name, num := range req.DailyIncome {
+				inventory[name] += num
+			}
+		}
+		if meal.Cook == nil {
+			continue
+		}
+		used := 0
+		for _, food := range meal.Cook.Recipe {
+			inventory[food.Name] -= food.Num
+			used += food.Num
+		}
+		for name, num := range meal.Filler {
+			inventory[name] -= num
+			used += num
+		}
+		for name, num := range inventory {
+			if num < 0 {
+				t.Fatalf("%s: %s runs short by %d", meal.Label(), name, -num)
+			}
+		}
+		if req.Pot > 0 && used > req.Pot {
+			t.Fatalf("%s: %d ingredients exceed pot %d", meal.Label(), used, req.Pot)
+		}
+		total += meal.Energy
+	}
+	if total != plan.TotalEnergy {
+		t.Errorf("sum of meal energy = %d, TotalEnergy = %d", total, plan.TotalEnergy)
+	}
+
+	leftover := make(map[string]int)
+	for name, num := range inventory {
+		if num > 0 {
+			leftover[name] = num
+		}
+	}
+	if !reflect.DeepEqual(leftover, plan.Leftover) {
+		t.Errorf("Leftover = %v, want %v", plan.Leftover, leftover)
+	}
+}
+
+func cookedCount(plan *Plan) map[string]int {
+	ret := make(map[string]int)
+	for _, meal := range plan.Meals {
+		if meal.Cook != nil {
+			ret[meal.Cook.Name]++
+		}
+	}
+	return ret
+}
+
+// 1カテゴリ・鍋の容量固定の小さな例で、最適な献立を見つける
+func TestMakePlanOptimum(t *testing.T) {
+	foods := []*Food{
+		{Name: "A", Energy: 100},
+		{Name: "B", Energy: 10},
+	}
+	cooks := []*Cook{
+		{Name: "huge", Energy: 5000, Recipe: []*Food{{Name: "A", Num: 3}}},
+		{Name: "big", Energy: 700, Recipe: []*Food{{Name: "A", Num: 2}}},
+		{Name: "small", Energy: 400, Recipe: []*Food{{Name: "A", Num: 1}}},
+	}
+	for _, tt := range []struct {
+		name       string
+		inventory  map[string]int
+		pot        int
+		want       int
+		wantCooked map[string]int
+		wantLeft   map[string]int
+	}{
+		{
+			// A x1の料理を3回で1200。先にA x2の料理を作ると1100にしかならず、A x3の料理は鍋に入らない
+			name:       "smaller recipes",
+			inventory:  map[string]int{"A": 3},
+			pot:        2,
+			want:       1200,
+			wantCooked: map[string]int{"small": 3},
+			wantLeft:   map[string]int{},
+		},
+		{
+			// A x1の料理の鍋の空きをB x2で埋めて420
+			name:       "filler",
+			inventory:  map[string]int{"A": 1, "B": 3},
+			pot:        3,
+			want:       420,
+			wantCooked: map[string]int{"small": 1},
+			wantLeft:   map[string]int{"B": 1},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := PlanRequest{
+				Foods:     foods,
+				Cooks:     cooks,
+				Inventory: tt.inventory,
+				Pot:       tt.pot,
+				Level:     1,
+			}
+
+			plan := MakePlan(req)
+			checkPlan(t, req, plan)
+			if plan.TotalEnergy != tt.want {
+				t.Errorf("TotalEnergy = %d, want %d\n%s", plan.TotalEnergy, tt.want, plan)
+			}
+			if got := cookedCount(plan); !reflect.DeepEqual(got, tt.wantCooked) {
+				t.Errorf("cooked = %v, want %v", got, tt.wantCooked)
+			}
+			if !reflect.DeepEqual(plan.Leftover, tt.wantLeft) {
+				t.Errorf("Leftover = %v, want %v", plan.Leftover, tt.wantLeft)
+			}
+		})
+	}
+}
+
+// 毎日の食材の増加で週の後半に作れるようになるレシピを、食材を温存して作る
+//
+//	Aは毎朝1個ずつ増え、週の合計は7個
+//	A x5で1000エナジーの料理は金曜の朝（5個たまったとき）から作れ、それと A x1の料理2回の1300が最適
+//	A x1の料理だけを毎日作ると1050にしかならない
+func TestMakePlanDailyIncome(t *testing.T) {
+	foods := []*Food{{Name: "A", Energy: 100}}
+	cooks := []*Cook{
+		{Name: "big", Energy: 1000, Recipe: []*Food{{Name: "A", Num: 5}}},
+		{Name: "small", Energy: 150, Recipe: []*Food{{Name: "A", Num: 1}}},
+	}
+	req := PlanRequest{
+		Foods:       foods,
+		Cooks:       cooks,
+		DailyIncome: map[string]int{"A": 1},
+		Pot:         5,
+		Level:       1,
+	}
+
+	plan := MakePlan(req)
+	checkPlan(t, req, plan)
+	if plan.TotalEnergy != 1300 {
+		t.Errorf("TotalEnergy = %d, want 1300\n%s", plan.TotalEnergy, plan)
+	}
+	if got, want := cookedCount(plan), map[string]int{"big": 1, "small": 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("cooked = %v, want %v", got, want)
+	}
+	for _, meal := range plan.Meals {
+		if meal.Cook != nil && meal.Cook.Name == "big" && meal.Day < 4 {
+			t.Errorf("big is cooked on %s, before enough A has come in", meal.Label())
+		}
+	}
+}
+
+// 作れるレシピがなければすべての食事で食材を温存する
+func TestMakePlanNothingMakable(t *testing.T) {
+	req := PlanRequest{
+		Foods:     []*Food{{Name: "A", Energy: 100}},
+		Cooks:     []*Cook{{Name: "big", Energy: 1000, Recipe: []*Food{{Name: "A", Num: 5}}}},
+		Inventory: map[string]int{"A": 4},
+		Pot:       5,
+	}
+
+	plan := MakePlan(req)
+	checkPlan(t, req, plan)
+	if plan.TotalEnergy != 0 || len(cookedCount(plan)) != 0 {
+		t.Errorf("plan cooks something:\n%s", plan)
+	}
+	if want := map[string]int{"A": 4}; !reflect.DeepEqual(plan.Leftover, want) {
+		t.Errorf("Leftover = %v, want %v", plan.Leftover, want)
+	}
+}
@@ -1,24 +1,36 @@
 package pokemonsleep
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"strconv"
-	"strings"
+	"time"
 
-	vision "cloud.google.com/go/vision/apiv1"
 	"go.uber.org/zap"
 )
 
 type Client struct {
 	SlackToken string `json:"-"`
 
-	Vision *vision.ImageAnnotatorClient `json:"-"`
-	Logger *zap.Logger                  `json:"-"`
+	Detector TextDetector `json:"-"`
+	Logger   *zap.Logger  `json:"-"`
+
+	// ユーザーごとの在庫の保存先（nilなら保存しない）
+	Inventories InventoryStore `json:"-"`
+	// OCRの文字列をまとめる距離（0ならDefaultClusterEps）
+	ClusterEps float64 `json:"-"`
+	// 食材アイコンの照合（nilならOCRだけで検出する）
+	Icons *IconMatcher `json:"-"`
+
+	// 食材名の索引（設定の読み込み時に作り、リクエストごとに使い回す）
+	// FoodMatcherは画像の文字列用、InputMatcherは入力された食材名用（別名でも照合する）
+	FoodMatcher  *FoodMatcher `json:"-"`
+	InputMatcher *FoodMatcher `json:"-"`
 
 	Foods  []*Food `json:"foods"`
 	Salad  []*Cook `json:"salad"`
@@ -27,130 +39,338 @@ type Client struct {
 }
 
 func NewClientFromRemote(ctx context.Context, token string, foodsConfigUrl, cooksConfigUrl string, logger *zap.Logger) (*Client, error) {
-	ret := &Client{
-		SlackToken: token,
-		Logger:     logger,
+	// vision clientの初期化
+	detector, err := NewVisionDetector(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return NewClientWithDetector(token, detector, foodsConfigUrl, cooksConfigUrl, logger)
+}
 
+func NewClientFromLocal(ctx context.Context, token string, foodsConfigPath, cooksConfigPath string, logger *zap.Logger) (*Client, error) {
 	// vision clientの初期化
-	vc, err := vision.NewImageAnnotatorClient(ctx)
+	detector, err := NewVisionDetector(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("init vision client failed: %w", err)
+		return nil, err
+	}
+	return NewClientWithDetector(token, detector, foodsConfigPath, cooksConfigPath, logger)
+}
+
+func NewClientWithDetector(token string, detector TextDetector, foodsConfigPath, cooksConfigPath string, logger *zap.Logger) (*Client, error) {
+	ret := &Client{
+		SlackToken: token,
+		Detector:   detector,
+		Logger:     logger,
 	}
-	ret.Vision = vc
 
 	// json config読み込み
-	err = LoadJsonConfig(foodsConfigUrl, ret)
+	// 失敗したときはdetector（Vision APIのgRPCクライアントなど）を閉じてから返す
+	err := LoadJsonConfig(foodsConfigPath, ret)
 	if err != nil {
-		return nil, fmt.Errorf("load json config (%s) failed: %w", foodsConfigUrl, err)
+		detector.Close()
+		return nil, fmt.Errorf("load json config (%s) failed: %w", foodsConfigPath, err)
 	}
-	err = LoadJsonConfig(cooksConfigUrl, ret)
+	err = LoadJsonConfig(cooksConfigPath, ret)
 	if err != nil {
-		return nil, fmt.Errorf("load json config (%s) failed: %w", cooksConfigUrl, err)
+		detector.Close()
+		return nil, fmt.Errorf("load json config (%s) failed: %w", cooksConfigPath, err)
 	}
+	ret.FoodMatcher = NewFoodMatcher(ret.Foods)
+	ret.InputMatcher = NewFoodMatcherWithAliases(ret.Foods)
 
 	ret.Logger.Info("init Client.")
 	return ret, nil
 }
 
-func NewClientFromLocal(ctx context.Context, token string, foodsConfigPath, cooksConfigPath string, logger *zap.Logger) (*Client, error) {
-	ret := &Client{
-		SlackToken: token,
-		Logger:     logger,
-	}
+func (c *Client) Close() error {
+	return c.Detector.Close()
+}
 
-	// vision clientの初期化
-	vc, err := vision.NewImageAnnotatorClient(ctx)
+const DefaultPotCapacity = 15
+
+var jst = time.FixedZone("JST", 9*60*60)
+
+// 添付された画像（スクロールして撮った複数枚でもよい）の食材で作れるレシピを評価する
+// localeは返信の言語
+func (c *Client) GetResult(ctx context.Context, user, text, locale string, files []ImageFile) (*Report, error) {
+	imgs, err := c.DownloadImages(files)
 	if err != nil {
-		return nil, fmt.Errorf("init vision client failed: %w", err)
+		return nil, err
 	}
-	ret.Vision = vc
+	return c.GetResultFromImages(ctx, user, text, locale, imgs...)
+}
 
-	// json config読み込み
-	err = LoadJsonConfig(foodsConfigPath, ret)
+func (c *Client) GetResultFromImages(ctx context.Context, user, text, locale string, imgs ...*Image) (*Report, error) {
+	dresults, err := c.DetectResults(ctx, imgs)
 	if err != nil {
-		return nil, fmt.Errorf("load json config (%s) failed: %w", foodsConfigPath, err)
+		return nil, err
 	}
-	err = LoadJsonConfig(cooksConfigPath, ret)
+	foods := MergeDetectResults(c.Logger, dresults)
+	diff, err := c.StoreInventory(ctx, user, foods)
 	if err != nil {
-		return nil, fmt.Errorf("load json config (%s) failed: %w", cooksConfigPath, err)
+		return nil, err
 	}
+	ret := c.NewReport(text, foods, diff)
+	ret.Details = NewFoodDetails(c.Foods, dresults, foods)
+	ret.Detections = dresults
+	ret.Translate(c.Translator(locale))
+	return ret, nil
+}
 
-	ret.Logger.Info("init Client.")
+// 保存済みの在庫で作れるレシピを評価する（在庫が保存されていなければnil）
+func (c *Client) GetResultFromInventory(ctx context.Context, user, text, locale string) (*Report, error) {
+	inventory, err := c.LoadInventory(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if inventory == nil {
+		return nil, nil
+	}
+	ret := c.NewReport(text, inventory.Foods, nil)
+	ret.Translate(c.Translator(locale))
 	return ret, nil
 }
 
-func (c *Client) Close() {
-	c.Vision.Close()
+// 在庫の食材で作れるレシピを評価する
+// カテゴリが指定されていなければ全カテゴリを評価する。diffは前回の在庫からの変化（なければnil）
+// 名前は日本語名のままなので、返信に使うときはTranslateする
+func (c *Client) NewReport(text string, foods, diff map[string]int) *Report {
+	dres := &DetectResult{
+		DetectedFoods: foods,
+		Foods:         c.Foods,
+	}
+
+	pot, _ := ParsePotCapacity(text)
+	level, _ := ParseRecipeLevel(text)
+	ret := &Report{
+		Foods: NewFoodCounts(c.Foods, foods),
+		Pot:   pot,
+		Level: level,
+	}
+	if diff != nil {
+		ret.Diff = NewFoodCounts(c.Foods, diff)
+	}
+
+	categories := []string{"サラダ", "カレー", "デザート"}
+	if category, cooks := c.CategoryCooks(text); cooks != nil {
+		categories = []string{category}
+	}
+	for _, category := range categories {
+		_, cooks := c.CategoryCooks(category)
+		makables, unmakables := SplitEvaluations(dres.Evaluate(cooks, pot, level))
+		ret.Categories = append(ret.Categories, &CategoryReport{
+			Name:       category,
+			Makables:   makables,
+			Unmakables: unmakables,
+		})
+		if pot > 0 && len(makables) > 0 && (ret.Recommended == nil || makables[0].Energy > ret.Recommended.Energy) {
+			ret.Recommended = makables[0]
+		}
+	}
+	return ret
 }
 
-func (c *Client) GetResultText(ctx context.Context, text, filetype, imageUrl string, originalW, originalH int) ([]string, error) {
-	resp, err := DownloadImage(imageUrl, c.SlackToken)
+// 画像の食材から1週間の献立を立てる
+func (c *Client) GetPlanText(ctx context.Context, user, text, locale string, files []ImageFile) (string, error) {
+	imgs, err := c.DownloadImages(files)
 	if err != nil {
-		return nil, fmt.Errorf("download image failed: %w", err)
+		return "", err
+	}
+	foods, _, err := c.DetectInventory(ctx, user, imgs...)
+	if err != nil {
+		return "", err
+	}
+	return c.GetPlanTextFromFoods(text, locale, foods), nil
+}
+
+// 在庫の食材から1週間の献立を立てる
+func (c *Client) GetPlanTextFromFoods(text, locale string, foods map[string]int) string {
+	tr := c.Translator(locale)
+	category, cooks := c.CategoryCooks(text)
+	if cooks == nil {
+		return tr.Msg("今週のカテゴリ（サラダ/カレー/デザート）を指定してください")
 	}
-	defer resp.Body.Close()
 
-	img, err := NewImage(resp.Body, filetype, originalW, originalH, c.Logger)
+	pot, ok := ParsePotCapacity(text)
+	if !ok {
+		pot = DefaultPotCapacity
+	}
+	level, _ := ParseRecipeLevel(text)
+	plan := MakePlan(PlanRequest{
+		Foods:       c.Foods,
+		Cooks:       cooks,
+		Inventory:   foods,
+		DailyIncome: ParseDailyIncome(text, c.InputMatcher),
+		Pot:         pot,
+		Level:       level,
+	})
+	return tr.Msg("%sの献立 (鍋%d):", tr.Msg(category), pot) + "\n" + plan.Format(tr)
+}
+
+// 保存済みの在庫を文字列にする
+func (c *Client) GetInventoryText(ctx context.Context, user, locale string) (string, error) {
+	inventory, err := c.LoadInventory(ctx, user)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Image:%w", err)
+		return "", err
+	}
+	if inventory == nil {
+		return Msg(locale, "在庫が保存されていません。食材の画像を添付してください"), nil
 	}
+	return Msg(locale, "在庫 (%s時点):", inventory.UpdatedAt.In(jst).Format("1/2 15:04")) + "\n" + FormatFoods(c.Foods, inventory.Foods, locale), nil
+}
 
-	dres, err := c.OCR(ctx, img)
+// 画像の食材を検出してユーザーの在庫として保存する（複数の画像はまとめて1つの在庫とする）
+// 前回の在庫があれば、その差分も返す（なければnil）
+func (c *Client) DetectInventory(ctx context.Context, user string, imgs ...*Image) (map[string]int, map[string]int, error) {
+	detected, err := c.DetectFoodsAll(ctx, imgs)
 	if err != nil {
-		return nil, fmt.Errorf("failed OCR:%w", err)
+		return nil, nil, err
+	}
+	diff, err := c.StoreInventory(ctx, user, detected)
+	if err != nil {
+		return nil, nil, err
+	}
+	return detected, diff, nil
+}
+
+// 検出した食材をユーザーの在庫として保存し、前回の在庫からの差分を返す（前回の在庫がなければnil）
+func (c *Client) StoreInventory(ctx context.Context, user string, detected map[string]int) (map[string]int, error) {
+	if c.Inventories == nil || user == "" {
+		return nil, nil
 	}
 
-	dres.DetectFoods(c.Foods)
+	prev, err := c.Inventories.Get(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("get inventory failed: %w", err)
+	}
+	err = c.Inventories.Put(ctx, &Inventory{
+		UserID:    user,
+		Foods:     detected,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("put inventory failed: %w", err)
+	}
+
+	if prev == nil {
+		return nil, nil
+	}
+	return DiffInventory(prev.Foods, detected), nil
+}
 
-	var ret []string
-	var foodsStr string
-	for k, v := range dres.DetectedFoods {
-		foodsStr += k + " x" + strconv.Itoa(v) + "\n"
+// メンション本文の修正（例: "リンゴ +3"）を保存済みの在庫に適用し、作れるレシピを評価し直す
+// 修正が含まれていなければnilを返す。食材に解決できなかった名前は注意書きとして返す
+func (c *Client) EditInventory(ctx context.Context, user, text, locale string) (*Report, []string, error) {
+	edits, unknowns, ambiguous := ParseInventoryEdits(text, c.InputMatcher)
+	notes := []string{}
+	for _, name := range unknowns {
+		notes = append(notes, Msg(locale, "「%s」は食材として認識できませんでした", name))
+	}
+	for _, name := range ambiguous {
+		notes = append(notes, Msg(locale, "「%s」は複数の食材に一致します", name))
+	}
+	if len(edits) == 0 {
+		return nil, notes, nil
 	}
-	ret = append(ret, foodsStr)
 
-	var makablesStr, unmakablesStr string
-	if strings.Contains(text, "サラダ") {
-		makablesStr, unmakablesStr = dres.GetCookResultString(c.Salad)
-	} else if strings.Contains(text, "カレー") {
-		makablesStr, unmakablesStr = dres.GetCookResultString(c.Curry)
-	} else if strings.Contains(text, "デザート") {
-		makablesStr, unmakablesStr = dres.GetCookResultString(c.Desert)
-	} else {
-		makables, unmakables := dres.GetCookResultString(c.Salad)
-		makablesStr += "\nサラダの" + makables
-		unmakablesStr += "\nサラダの" + unmakables
-		makables, unmakables = dres.GetCookResultString(c.Curry)
-		makablesStr += "\nカレーの" + makables
-		unmakablesStr += "\nカレーの" + unmakables
-		makables, unmakables = dres.GetCookResultString(c.Desert)
-		makablesStr += "\nデザートの" + makables
-		unmakablesStr += "\nデザートの" + unmakables
+	inventory, err := c.LoadInventory(ctx, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	prev := map[string]int{}
+	if inventory != nil {
+		prev = inventory.Foods
+	}
+	foods := ApplyInventoryEdits(prev, edits)
+	if c.Inventories != nil {
+		err = c.Inventories.Put(ctx, &Inventory{
+			UserID:    user,
+			Foods:     foods,
+			UpdatedAt: time.Now(),
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("put inventory failed: %w", err)
+		}
 	}
-	ret = append(ret, makablesStr, unmakablesStr)
 
-	return ret, nil
+	ret := c.NewReport(text, foods, DiffInventory(prev, foods))
+	ret.Notes = notes
+	ret.Translate(c.Translator(locale))
+	return ret, notes, nil
 }
 
-func (c *Client) OCR(ctx context.Context, img *Image) (*DetectResult, error) {
-	// Vision AIに読み込ませる準備
-	visionImg, err := vision.NewImageFromReader(img.Bytes)
+// 保存済みの在庫を読み込む（保存されていなければnil）
+func (c *Client) LoadInventory(ctx context.Context, user string) (*Inventory, error) {
+	if c.Inventories == nil {
+		return nil, nil
+	}
+	inventory, err := c.Inventories.Get(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("get inventory failed: %w", err)
+	}
+	return inventory, nil
+}
+
+// メンション本文で指定された料理のカテゴリ名（日本語）とレシピ一覧（指定がなければ空文字とnil）
+// 英語のカテゴリ名（salad/curry/dessert）も受け付ける
+func (c *Client) CategoryCooks(text string) (string, []*Cook) {
+	if HasKeyword(text, "サラダ", "salad", "salads") {
+		return "サラダ", c.Salad
+	} else if HasKeyword(text, "カレー", "curry", "curries", "stew", "stews") {
+		return "カレー", c.Curry
+	} else if HasKeyword(text, "デザート", "dessert", "desserts", "drink", "drinks") {
+		return "デザート", c.Desert
+	}
+	return "", nil
+}
+
+// Slackの画像をダウンロードする
+func (c *Client) DownloadImage(imageUrl, filetype string, originalW, originalH int) (*Image, error) {
+	resp, err := DownloadImage(imageUrl, c.SlackToken)
 	if err != nil {
-		return nil, fmt.Errorf("load file failed: %w", err)
+		return nil, fmt.Errorf("download image failed: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// 実行
-	annotations, err := c.Vision.DetectTexts(ctx, visionImg, nil, 0)
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read image failed: %w", err)
+	}
+
+	// Slackの報告する大きさは縮小後のことがあるので、画像から実際の大きさを読む
+	img, err := DecodeImage(data, c.Logger)
+	if err != nil {
+		c.Logger.Warn("decode image failed, use size reported by slack.", zap.String("filetype", filetype), zap.Error(err))
+		img, err = NewImage(bytes.NewReader(data), filetype, originalW, originalH, c.Logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Image:%w", err)
+		}
+	} else if img.Width != originalW || img.Height != originalH {
+		c.Logger.Info("image size differs from slack.", zap.Int("width", img.Width), zap.Int("height", img.Height), zap.Int("original_w", originalW), zap.Int("original_h", originalH))
+	}
+	return img, nil
+}
+
+// OCRして画像に写っている食材を検出する
+func (c *Client) DetectFoods(ctx context.Context, img *Image) (*DetectResult, error) {
+	dres, err := c.OCR(ctx, img)
+	if err != nil {
+		return nil, fmt.Errorf("failed OCR:%w", err)
+	}
+
+	dres.DetectFoods(c.FoodMatcher)
+	return dres, nil
+}
+
+func (c *Client) OCR(ctx context.Context, img *Image) (*DetectResult, error) {
+	boxes, err := c.Detector.DetectTexts(ctx, img.Bytes)
 	if err != nil {
-		return nil, fmt.Errorf("execute ocr failed: %w", err)
+		return nil, fmt.Errorf("detect texts failed: %w", err)
 	}
 
-	// err = img.UpdateImage(annotations)
-	// if err != nil {
-	// 	return fmt.Errorf("NewImage failed: %w", err)
-	// }
-	dresult := NewDetectedResult(img, annotations)
+	dresult := NewDetectedResult(img, boxes)
+	dresult.ClusterEps = c.ClusterEps
+	dresult.Icons = c.Icons
 
 	return dresult, nil
 }
@@ -0,0 +1,47 @@
+package pokemonsleep
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+type closeRecorder struct {
+	closed bool
+}
+
+func (d *closeRecorder) DetectTexts(ctx context.Context, r io.Reader) ([]TextBox, error) {
+	return nil, nil
+}
+
+func (d *closeRecorder) Close() error {
+	d.closed = true
+	return nil
+}
+
+// 設定の読み込みに失敗したらdetectorを閉じる
+func TestNewClientWithDetectorClosesDetectorOnError(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		foods      string
+		cooks      string
+		wantClosed bool
+	}{
+		{name: "foods not found", foods: "not_found.json", cooks: "../../data/cooks.json", wantClosed: true},
+		{name: "cooks not found", foods: "../../data/foods.json", cooks: "not_found.json", wantClosed: true},
+		{name: "ok", foods: "../../data/foods.json", cooks: "../../data/cooks.json", wantClosed: false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			detector := &closeRecorder{}
+			_, err := NewClientWithDetector("", detector, tt.foods, tt.cooks, zap.NewNop())
+			if (err != nil) != tt.wantClosed {
+				t.Fatalf("err = %v", err)
+			}
+			if detector.closed != tt.wantClosed {
+				t.Errorf("closed = %v, want %v", detector.closed, tt.wantClosed)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package pokemonsleep
+
+import (
+	"strconv"
+	"strings"
+)
+
+type FoodCount struct {
+	Name string `json:"name"`
+	Num  int    `json:"num"`
+}
+
+// カテゴリ（サラダ/カレー/デザート）ごとの評価
+// Makablesは見込みエナジーの高い順、Unmakablesはcooks.jsonの順
+type CategoryReport struct {
+	Name       string              `json:"name"`
+	Makables   []*RecipeEvaluation `json:"makables"`
+	Unmakables []*RecipeEvaluation `json:"unmakables"`
+}
+
+// 在庫に対するレシピの評価結果
+type Report struct {
+	// 返信の言語（名前と文言はTranslateでこの言語にする）
+	Locale string `json:"locale"`
+
+	Foods []FoodCount `json:"foods"`
+	// 前回の在庫からの変化（前回の在庫がなければnil）
+	Diff []FoodCount `json:"diff,omitempty"`
+
+	Pot   int `json:"pot,omitempty"`
+	Level int `json:"level,omitempty"`
+
+	// 鍋の容量が指定されたときのおすすめ（作れるレシピがなければnil）
+	Recommended *RecipeEvaluation `json:"recommended,omitempty"`
+	Categories  []*CategoryReport `json:"categories"`
+
+	Notes []string `json:"notes,omitempty"`
+
+	// 画像から読み取った食材ごとの確からしさ（画像から評価したときのみ）
+	Details []*FoodDetail `json:"details,omitempty"`
+
+	// 画像ごとの検出結果（画像から評価したときのみ。デバッグ用の画像を描くのに使う）
+	Detections []*DetectResult `json:"-"`
+}
+
+// 画像から読み取った食材1つ分の確からしさ
+type FoodDetail struct {
+	Name string `json:"name"`
+	Num  int    `json:"num"`
+	// 食材名として読んだOCRの文字列（アイコンで見つけた場合は空）
+	Source     string  `json:"source"`
+	Confidence float64 `json:"confidence"`
+	// 次点以降の食材名の候補
+	Alternatives []string `json:"alternatives,omitempty"`
+	NumRead      bool     `json:"num_read"`
+	Icon         bool     `json:"icon,omitempty"`
+	Uncertain    bool     `json:"uncertain"`
+}
+
+// 確認を促す一言（例: "シッポ? 数が読めませんでした"）
+func (f *FoodDetail) Warning(locale string) string {
+	source := f.Source
+	if f.Icon {
+		source = Msg(locale, "%s(アイコン)", f.Name)
+	}
+	if !f.NumRead {
+		return Msg(locale, "%s? 数が読めませんでした", source)
+	}
+	ret := Msg(locale, "%s? %sとして読みました", source, f.Name)
+	if len(f.Alternatives) > 0 {
+		ret += Msg(locale, "（候補: %s）", strings.Join(f.Alternatives, Msg(locale, "、")))
+	}
+	return ret
+}
+
+// 画像ごとの読み取りを食材ごとにまとめる
+// 同じ食材が複数の画像に写っていれば、在庫として採った個数を読んだものを優先し、その中で最も確かなものを残す
+func NewFoodDetails(foods []*Food, dresults []*DetectResult, nums map[string]int) []*FoodDetail {
+	best := make(map[string]*FoodMatch)
+	for _, dres := range dresults {
+		for _, match := range dres.Matches {
+			name := match.Food.Name
+			prev, ok := best[name]
+			if !ok || betterMatch(match, prev, nums[name]) {
+				best[name] = match
+			}
+		}
+	}
+
+	ret := []*FoodDetail{}
+	for _, name := range sortedFoodNames(foods, nums) {
+		match, ok := best[name]
+		if !ok {
+			continue
+		}
+		detail := &FoodDetail{
+			Name:       name,
+			Num:        nums[name],
+			Confidence: match.Confidence,
+			NumRead:    match.NumRead,
+			Icon:       match.Icon,
+			Uncertain:  match.Uncertain(),
+		}
+		if !match.Icon {
+			detail.Source = match.Text.Joined()
+		}
+		for _, candidate := range match.Alternatives {
+			detail.Alternatives = append(detail.Alternatives, candidate.Food.Name)
+		}
+		ret = append(ret, detail)
+	}
+	return ret
+}
+
+func betterMatch(m, prev *FoodMatch, num int) bool {
+	if (m.NumRead && m.Num == num) != (prev.NumRead && prev.Num == num) {
+		return m.NumRead && m.Num == num
+	}
+	if m.Uncertain() != prev.Uncertain() {
+		return !m.Uncertain()
+	}
+	return m.Confidence > prev.Confidence
+}
+
+// 確認を促す一言の一覧
+func (r *Report) Warnings() []string {
+	ret := []string{}
+	for _, detail := range r.Details {
+		if detail.Uncertain {
+			ret = append(ret, detail.Warning(r.Locale))
+		}
+	}
+	return ret
+}
+
+// 食材名・料理名・カテゴリ名と文言をtrの言語にする
+func (r *Report) Translate(tr *Translator) {
+	r.Locale = tr.Locale
+	for i := range r.Foods {
+		r.Foods[i].Name = tr.Name(r.Foods[i].Name)
+	}
+	for i := range r.Diff {
+		r.Diff[i].Name = tr.Name(r.Diff[i].Name)
+	}
+	// Recommendedはいずれかのカテゴリの評価と同じものなので、カテゴリの側で訳す
+	for _, category := range r.Categories {
+		category.Name = tr.Msg(category.Name)
+		for _, evaluation := range append(append([]*RecipeEvaluation{}, category.Makables...), category.Unmakables...) {
+			evaluation.Name = tr.Name(evaluation.Name)
+			for i := range evaluation.Ingredients {
+				evaluation.Ingredients[i].Name = tr.Name(evaluation.Ingredients[i].Name)
+			}
+		}
+	}
+	for _, detail := range r.Details {
+		detail.Name = tr.Name(detail.Name)
+		for i := range detail.Alternatives {
+			detail.Alternatives[i] = tr.Name(detail.Alternatives[i])
+		}
+	}
+}
+
+func NewFoodCounts(foods []*Food, nums map[string]int) []FoodCount {
+	ret := []FoodCount{}
+	for _, name := range sortedFoodNames(foods, nums) {
+		ret = append(ret, FoodCount{Name: name, Num: nums[name]})
+	}
+	return ret
+}
+
+// プレーンテキストのメッセージ（在庫、作れるレシピ、作れないレシピの3通）
+func (r *Report) Texts() []string {
+	foodsStr := ""
+	for _, food := range r.Foods {
+		foodsStr += food.Name + " x" + strconv.Itoa(food.Num) + "\n"
+	}
+	if r.Diff != nil {
+		foodsStr += "\n" + formatDiff(r.Diff, r.Locale)
+	}
+	for _, note := range r.Notes {
+		foodsStr += note + "\n"
+	}
+	if warnings := r.Warnings(); len(warnings) > 0 {
+		foodsStr += "\n" + Msg(r.Locale, "確認してください") + ":\n"
+		for _, warning := range warnings {
+			foodsStr += "    " + warning + "\n"
+		}
+	}
+
+	var makablesStr, unmakablesStr string
+	for _, category := range r.Categories {
+		if len(r.Categories) == 1 {
+			makablesStr = FormatMakables(Msg(r.Locale, "作れるレシピ"), category.Makables, r.Locale)
+			unmakablesStr = FormatUnmakables(Msg(r.Locale, "作れないレシピ"), category.Unmakables, r.Pot, r.Locale)
+		} else {
+			makablesStr += "\n" + FormatMakables(Msg(r.Locale, "%sの作れるレシピ", category.Name), category.Makables, r.Locale)
+			unmakablesStr += "\n" + FormatUnmakables(Msg(r.Locale, "%sの作れないレシピ", category.Name), category.Unmakables, r.Pot, r.Locale)
+		}
+	}
+
+	// 鍋の容量が指定されていれば、その鍋で作れるおすすめのレシピを添える
+	if r.Pot > 0 {
+		if r.Recommended != nil {
+			makablesStr = Msg(r.Locale, "鍋%dのおすすめ: %s (%dエナジー)", r.Pot, r.Recommended.Name, r.Recommended.Energy) + "\n" + makablesStr
+		} else {
+			makablesStr = Msg(r.Locale, "鍋%dで作れるレシピはありません", r.Pot) + "\n" + makablesStr
+		}
+	}
+	return []string{foodsStr, makablesStr, unmakablesStr}
+}
+
+func FormatMakables(title string, evaluations []*RecipeEvaluation, locale string) string {
+	var ret string
+	for _, evaluation := range evaluations {
+		ret += "    :o: " + Msg(locale, "%s (%dエナジー)", evaluation.Name, evaluation.Energy) + "\n"
+		for _, ingredient := range evaluation.Ingredients {
+			ret += "          ・" + ingredient.Name + " x" + strconv.Itoa(ingredient.Need) + "\n"
+		}
+	}
+	return title + ":\n" + ret
+}
+
+func FormatUnmakables(title string, evaluations []*RecipeEvaluation, pot int, locale string) string {
+	var ret string
+	for _, evaluation := range evaluations {
+		if evaluation.TooLarge {
+			ret += "    :x: " + Msg(locale, "%s (鍋に入りきりません: 食材%d個 / 鍋%d)", evaluation.Name, evaluation.TotalIngredients, pot) + "\n"
+		} else {
+			ret += "    :x: " + evaluation.Name + "\n"
+		}
+		for _, ingredient := range evaluation.Ingredients {
+			if ingredient.Shortage > 0 {
+				ret += "          :heavy_multiplication_x: " + ingredient.Name + " x" + strconv.Itoa(ingredient.Need) + " " + Msg(locale, "あと%d", ingredient.Shortage) + "\n"
+			} else {
+				ret += "          :white_check_mark: " + ingredient.Name + " x" + strconv.Itoa(ingredient.Need) + "\n"
+			}
+		}
+	}
+	return title + ":\n" + ret
+}
+
+func formatDiff(diff []FoodCount, locale string) string {
+	if len(diff) == 0 {
+		return Msg(locale, "前回から変化はありません") + "\n"
+	}
+	ret := Msg(locale, "前回からの変化") + ":\n"
+	for _, d := range diff {
+		if d.Num > 0 {
+			ret += "    " + d.Name + " +" + strconv.Itoa(d.Num) + "\n"
+		} else {
+			ret += "    " + d.Name + " " + strconv.Itoa(d.Num) + "\n"
+		}
+	}
+	return ret
+}
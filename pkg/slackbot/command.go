@@ -0,0 +1,144 @@
+package slackbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/SotaEndo0214/pbbotfunc/pkg/pokemonsleep"
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// スラッシュコマンド（例: "/pokesleep recipes curry"）のサブコマンドを処理する関数
+type CommandFunc func(*SlackBot, context.Context, *CommandRequest) error
+
+// サブコマンド1つ分
+type Command struct {
+	Name string
+	// ヘルプに表示する使い方（例: "recipes [salad|curry|dessert]"）と説明（日本語。返信の言語に訳して表示する）
+	Usage       string
+	Description string
+	Handler     CommandFunc
+}
+
+// 受け取ったスラッシュコマンド
+type CommandRequest struct {
+	slack.SlashCommand
+	// サブコマンド名（小文字）と、それを除いた引数
+	Name string
+	Args string
+}
+
+// スラッシュコマンドの本文（例: "recipes curry 鍋30"）をサブコマンド名と引数に分ける
+// サブコマンド名がなければ"help"とする
+func NewCommandRequest(cmd slack.SlashCommand) *CommandRequest {
+	ret := &CommandRequest{SlashCommand: cmd, Name: "help"}
+	fields := strings.Fields(cmd.Text)
+	if len(fields) > 0 {
+		ret.Name = strings.ToLower(fields[0])
+		ret.Args = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(cmd.Text), fields[0]))
+	}
+	return ret
+}
+
+// サブコマンドの一覧
+// function.goのイベント処理に手を入れずにサブコマンドを足せるよう、名前で引けるようにしておく
+type CommandRegistry struct {
+	commands map[string]*Command
+	// ヘルプに表示する順（登録順）
+	names []string
+}
+
+// helpだけを登録したCommandRegistryを返す
+func NewCommandRegistry() *CommandRegistry {
+	ret := &CommandRegistry{
+		commands: make(map[string]*Command),
+	}
+	ret.Register(&Command{
+		Name:        "help",
+		Usage:       "help",
+		Description: "コマンドの一覧を表示する",
+		Handler: func(s *SlackBot, ctx context.Context, req *CommandRequest) error {
+			locale := pokemonsleep.ResolveLocale(req.Args, s.UserLocale(ctx, req.UserID))
+			return s.RespondText(req, ret.Help(req.Command, locale))
+		},
+	})
+	return ret
+}
+
+// 同じ名前のサブコマンドがあれば置き換える
+func (r *CommandRegistry) Register(cmd *Command) {
+	if _, ok := r.commands[cmd.Name]; !ok {
+		r.names = append(r.names, cmd.Name)
+	}
+	r.commands[cmd.Name] = cmd
+}
+
+func (r *CommandRegistry) Lookup(name string) (*Command, bool) {
+	cmd, ok := r.commands[name]
+	return cmd, ok
+}
+
+// 登録順のサブコマンドの一覧
+func (r *CommandRegistry) Commands() []*Command {
+	ret := []*Command{}
+	for _, name := range r.names {
+		ret = append(ret, r.commands[name])
+	}
+	return ret
+}
+
+// サブコマンドの使い方の一覧（commandはスラッシュコマンド名。例: "/pokesleep"）
+func (r *CommandRegistry) Help(command, locale string) string {
+	ret := pokemonsleep.Msg(locale, "使い方:") + "\n"
+	for _, cmd := range r.Commands() {
+		ret += "    `" + command + " " + cmd.Usage + "`  " + pokemonsleep.Msg(locale, cmd.Description) + "\n"
+	}
+	return ret
+}
+
+// スラッシュコマンドをサブコマンドに振り分けてworkerで処理する
+// 知らないサブコマンドであればヘルプを返す
+func (s *SlackBot) Dispatch(ctx context.Context, cmd slack.SlashCommand) {
+	req := NewCommandRequest(cmd)
+	s.Logger.Info("command received.", zap.String("command", req.Command), zap.String("name", req.Name))
+	s.run(ctx, func(ctx context.Context) error {
+		if s.Commands == nil {
+			return fmt.Errorf("no commands registered for %s", req.Command)
+		}
+		command, ok := s.Commands.Lookup(req.Name)
+		if !ok {
+			locale := pokemonsleep.ResolveLocale(req.Args, s.UserLocale(ctx, req.UserID))
+			return s.RespondText(req, pokemonsleep.Msg(locale, "「%s」というコマンドはありません", req.Name)+"\n"+s.Commands.Help(req.Command, locale))
+		}
+		if err := command.Handler(s, ctx, req); err != nil {
+			return fmt.Errorf("command %s failed: %w", req.Name, err)
+		}
+		return nil
+	})
+}
+
+// コマンドを実行したユーザーにだけ見えるよう、response_urlに返信する
+func (s *SlackBot) RespondText(req *CommandRequest, text string) error {
+	return s.respond(req, s.Renderer.Text(text))
+}
+
+// レシピの評価結果をRendererで組み立てて、コマンドを実行したユーザーに返信する
+func (s *SlackBot) RespondReport(req *CommandRequest, report *pokemonsleep.Report) error {
+	for _, options := range s.Renderer.Report(report) {
+		if err := s.respond(req, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SlackBot) respond(req *CommandRequest, options []slack.MsgOption) error {
+	options = append(options, slack.MsgOptionResponseURL(req.ResponseURL, slack.ResponseTypeEphemeral))
+	_, _, err := s.Api.PostMessage(req.ChannelID, options...)
+	if err != nil {
+		return fmt.Errorf("respond to command failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"go.uber.org/zap"
+)
+
+// Slack APIとresponse_urlのスタブ
+// response_urlに送られた本文をresponsesに流す
+func newCommandServer(t *testing.T, responses chan<- string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/users.info", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok": true, "user": {"id": "U1", "locale": "ja-JP"}}`)
+	})
+	mux.HandleFunc("/respond", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		responses <- string(body)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"ok": true}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newCommandBot(srv *httptest.Server) *SlackBot {
+	bot := NewSlackBot(zap.NewNop(), "xoxb-test", testSecret, nil)
+	bot.Api = slack.New("xoxb-test", slack.OptionAPIURL(srv.URL+"/"))
+	bot.Renderer = TextRenderer{}
+	return bot
+}
+
+func commandBody(srv *httptest.Server, text string) string {
+	return url.Values{
+		"command":      {"/pokesleep"},
+		"text":         {text},
+		"user_id":      {"U1"},
+		"channel_id":   {"C1"},
+		"team_id":      {"T1"},
+		"response_url": {srv.URL + "/respond"},
+	}.Encode()
+}
+
+func handleCommand(t *testing.T, bot *SlackBot, secret, body string) (int, error) {
+	t.Helper()
+	req := newSignedRequest(t, secret, "application/x-www-form-urlencoded", body)
+	w := httptest.NewRecorder()
+	err := bot.HandleRequest(context.Background(), w, req)
+	bot.Wait()
+	return w.Code, err
+}
+
+// 署名が合わないスラッシュコマンドは401を返し、サブコマンドを実行しない
+func TestHandleCommandRequestRejectsBadSignature(t *testing.T) {
+	srv := newCommandServer(t, make(chan string, 1))
+	bot := newCommandBot(srv)
+	called := false
+	bot.Commands.Register(&Command{Name: "recipes", Usage: "recipes", Handler: func(s *SlackBot, ctx context.Context, req *CommandRequest) error {
+		called = true
+		return nil
+	}})
+
+	code, err := handleCommand(t, bot, "wrong-secret", commandBody(srv, "recipes curry"))
+	if err == nil {
+		t.Error("HandleRequest succeeded with a bad signature")
+	}
+	if code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", code)
+	}
+	if called {
+		t.Error("subcommand was called")
+	}
+}
+
+// サブコマンド名で振り分け、残りを引数として渡す
+func TestHandleCommandRequestRoutesSubcommand(t *testing.T) {
+	srv := newCommandServer(t, make(chan string, 1))
+	bot := newCommandBot(srv)
+	calls := map[string][]string{}
+	for _, name := range []string{"recipes", "inventory", "plan"} {
+		name := name
+		bot.Commands.Register(&Command{Name: name, Usage: name, Handler: func(s *SlackBot, ctx context.Context, req *CommandRequest) error {
+			calls[name] = append(calls[name], req.Args)
+			return nil
+		}})
+	}
+
+	code, err := handleCommand(t, bot, testSecret, commandBody(srv, "Recipes curry 鍋30"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK {
+		t.Errorf("status = %d, want 200", code)
+	}
+	if len(calls) != 1 || len(calls["recipes"]) != 1 || calls["recipes"][0] != "curry 鍋30" {
+		t.Errorf("calls = %v, want recipes with \"curry 鍋30\"", calls)
+	}
+}
+
+// 知らないサブコマンドには、その旨と使い方を本人にだけ返す
+func TestHandleCommandRequestUnknownSubcommand(t *testing.T) {
+	responses := make(chan string, 1)
+	srv := newCommandServer(t, responses)
+	bot := newCommandBot(srv)
+	bot.Commands.Register(&Command{Name: "recipes", Usage: "recipes [salad|curry|dessert]", Description: "作れるレシピを表示する", Handler: func(s *SlackBot, ctx context.Context, req *CommandRequest) error {
+		t.Error("recipes was called")
+		return nil
+	}})
+
+	code, err := handleCommand(t, bot, testSecret, commandBody(srv, "foo bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK {
+		t.Errorf("status = %d, want 200", code)
+	}
+
+	var msg struct {
+		Text         string `json:"text"`
+		ResponseType string `json:"response_type"`
+	}
+	select {
+	case body := <-responses:
+		if err := json.Unmarshal([]byte(body), &msg); err != nil {
+			t.Fatalf("unmarshal response (%s) failed: %v", body, err)
+		}
+	default:
+		t.Fatal("no response was sent to response_url")
+	}
+	if msg.ResponseType != slack.ResponseTypeEphemeral {
+		t.Errorf("response_type = %q, want ephemeral", msg.ResponseType)
+	}
+	for _, want := range []string{"「foo」というコマンドはありません", "`/pokesleep help`", "`/pokesleep recipes [salad|curry|dessert]`"} {
+		if !strings.Contains(msg.Text, want) {
+			t.Errorf("response %q does not contain %q", msg.Text, want)
+		}
+	}
+}
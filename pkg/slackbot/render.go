@@ -0,0 +1,229 @@
+package slackbot
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/SotaEndo0214/pbbotfunc/pkg/pokemonsleep"
+	"github.com/slack-go/slack"
+)
+
+const (
+	// Block Kitの制限（1メッセージのブロック数、sectionのテキスト長、sectionのfields数）
+	maxBlocksPerMessage = 50
+	maxSectionText      = 2900
+	maxSectionFields    = 10
+
+	progressBarWidth = 10
+)
+
+// 返信メッセージの組み立て方
+type Renderer interface {
+	// レシピの評価結果を、投稿するメッセージごとのオプションにする
+	Report(report *pokemonsleep.Report) [][]slack.MsgOption
+	Text(text string) []slack.MsgOption
+}
+
+// nameが"text"ならプレーンテキスト、それ以外はBlock Kitで返信する
+func NewRenderer(name string) Renderer {
+	if name == "text" {
+		return TextRenderer{}
+	}
+	return BlockRenderer{}
+}
+
+// 在庫・作れるレシピ・作れないレシピをそれぞれプレーンテキストで返信する
+type TextRenderer struct{}
+
+func (TextRenderer) Report(report *pokemonsleep.Report) [][]slack.MsgOption {
+	ret := [][]slack.MsgOption{}
+	for _, text := range report.Texts() {
+		ret = append(ret, []slack.MsgOption{slack.MsgOptionText(text, false)})
+	}
+	return ret
+}
+
+func (TextRenderer) Text(text string) []slack.MsgOption {
+	return []slack.MsgOption{slack.MsgOptionText(text, false)}
+}
+
+// Block Kitで返信する
+// 在庫は食材ごとのfields、レシピはカテゴリごとのsectionにまとめ、足りない食材は進捗バーで表示する
+// Block Kitには折りたたみがないので、作れないレシピはカテゴリごとに1つのsectionにまとめ、長いものはSlackの「もっと見る」に任せる
+type BlockRenderer struct{}
+
+// 文言はreport.Localeの言語にする
+func (BlockRenderer) Report(report *pokemonsleep.Report) [][]slack.MsgOption {
+	locale := report.Locale
+	blocks := []slack.Block{
+		slack.NewHeaderBlock(plainText(pokemonsleep.Msg(locale, "食材"))),
+	}
+	blocks = append(blocks, foodsBlocks(report.Foods, locale)...)
+	if report.Diff != nil {
+		blocks = append(blocks, slack.NewContextBlock("", markdown(diffText(report.Diff, locale))))
+	}
+	for _, note := range report.Notes {
+		blocks = append(blocks, slack.NewSectionBlock(markdown(":warning: "+note), nil, nil))
+	}
+	if warnings := report.Warnings(); len(warnings) > 0 {
+		lines := []string{}
+		for _, warning := range warnings {
+			lines = append(lines, ":grey_question: "+warning)
+		}
+		blocks = append(blocks, sectionBlocks("*"+pokemonsleep.Msg(locale, "確認してください")+"*", lines)...)
+	}
+
+	if report.Pot > 0 {
+		blocks = append(blocks, slack.NewDividerBlock())
+		if report.Recommended != nil {
+			blocks = append(blocks, slack.NewSectionBlock(markdown(":star: "+pokemonsleep.Msg(locale, "鍋%dのおすすめ: %s (%dエナジー)", report.Pot, "*"+report.Recommended.Name+"*", report.Recommended.Energy)), nil, nil))
+		} else {
+			blocks = append(blocks, slack.NewSectionBlock(markdown(pokemonsleep.Msg(locale, "鍋%dで作れるレシピはありません", report.Pot)), nil, nil))
+		}
+	}
+
+	for _, category := range report.Categories {
+		blocks = append(blocks, slack.NewDividerBlock(), slack.NewHeaderBlock(plainText(category.Name)))
+		blocks = append(blocks, sectionBlocks("*"+pokemonsleep.Msg(locale, "作れるレシピ")+"*", makableLines(category.Makables, locale))...)
+		blocks = append(blocks, sectionBlocks("*"+pokemonsleep.Msg(locale, "作れないレシピ")+"*", unmakableLines(category.Unmakables, report.Pot, locale))...)
+	}
+
+	blocks = append(blocks, slack.NewContextBlock("", markdown(footerText(report))))
+
+	// 通知やブロック非対応のクライアント向けの代替テキスト
+	fallback := pokemonsleep.Msg(locale, "食材%d種類を読み取りました", len(report.Foods))
+	ret := [][]slack.MsgOption{}
+	for len(blocks) > 0 {
+		n := len(blocks)
+		if n > maxBlocksPerMessage {
+			n = maxBlocksPerMessage
+		}
+		ret = append(ret, []slack.MsgOption{
+			slack.MsgOptionText(fallback, false),
+			slack.MsgOptionBlocks(blocks[:n]...),
+		})
+		blocks = blocks[n:]
+	}
+	return ret
+}
+
+func (BlockRenderer) Text(text string) []slack.MsgOption {
+	return []slack.MsgOption{
+		slack.MsgOptionText(text, false),
+		slack.MsgOptionBlocks(sectionBlocks("", strings.Split(strings.TrimRight(text, "\n"), "\n"))...),
+	}
+}
+
+func plainText(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.PlainTextType, text, true, false)
+}
+
+func markdown(text string) *slack.TextBlockObject {
+	return slack.NewTextBlockObject(slack.MarkdownType, text, false, false)
+}
+
+func foodsBlocks(foods []pokemonsleep.FoodCount, locale string) []slack.Block {
+	if len(foods) == 0 {
+		return []slack.Block{slack.NewSectionBlock(markdown(pokemonsleep.Msg(locale, "食材が見つかりませんでした")), nil, nil)}
+	}
+	ret := []slack.Block{}
+	for i := 0; i < len(foods); i += maxSectionFields {
+		fields := []*slack.TextBlockObject{}
+		for _, food := range foods[i:min(i+maxSectionFields, len(foods))] {
+			fields = append(fields, markdown(food.Name+"  *x"+strconv.Itoa(food.Num)+"*"))
+		}
+		ret = append(ret, slack.NewSectionBlock(nil, fields, nil))
+	}
+	return ret
+}
+
+// 行をsectionのテキスト長の制限に収まるよう複数のsectionに分ける
+func sectionBlocks(title string, lines []string) []slack.Block {
+	ret := []slack.Block{}
+	text := title
+	for _, line := range lines {
+		if len(text)+len(line)+1 > maxSectionText {
+			ret = append(ret, slack.NewSectionBlock(markdown(text), nil, nil))
+			text = ""
+		}
+		if text != "" {
+			text += "\n"
+		}
+		text += line
+	}
+	if text != "" {
+		ret = append(ret, slack.NewSectionBlock(markdown(text), nil, nil))
+	}
+	return ret
+}
+
+func makableLines(evaluations []*pokemonsleep.RecipeEvaluation, locale string) []string {
+	if len(evaluations) == 0 {
+		return []string{pokemonsleep.Msg(locale, "なし")}
+	}
+	ret := []string{}
+	for _, evaluation := range evaluations {
+		ingredients := []string{}
+		for _, ingredient := range evaluation.Ingredients {
+			ingredients = append(ingredients, ingredient.Name+" x"+strconv.Itoa(ingredient.Need))
+		}
+		ret = append(ret, ":o: "+pokemonsleep.Msg(locale, "%s (%dエナジー)", "*"+evaluation.Name+"*", evaluation.Energy), "        "+strings.Join(ingredients, pokemonsleep.Msg(locale, "、")))
+	}
+	return ret
+}
+
+func unmakableLines(evaluations []*pokemonsleep.RecipeEvaluation, pot int, locale string) []string {
+	if len(evaluations) == 0 {
+		return []string{pokemonsleep.Msg(locale, "なし")}
+	}
+	ret := []string{}
+	for _, evaluation := range evaluations {
+		if evaluation.TooLarge {
+			ret = append(ret, ":x: "+pokemonsleep.Msg(locale, "%s (鍋%dに入りきりません)", "*"+evaluation.Name+"*", pot))
+		} else {
+			ret = append(ret, ":x: *"+evaluation.Name+"*")
+		}
+		for _, ingredient := range evaluation.Ingredients {
+			line := "        " + progressBar(ingredient.Have, ingredient.Need) + " " + ingredient.Name + " " + strconv.Itoa(min(ingredient.Have, ingredient.Need)) + "/" + strconv.Itoa(ingredient.Need)
+			if ingredient.Shortage > 0 {
+				line += " (" + pokemonsleep.Msg(locale, "あと%d", ingredient.Shortage) + ")"
+			}
+			ret = append(ret, line)
+		}
+	}
+	return ret
+}
+
+func progressBar(have, need int) string {
+	filled := progressBarWidth
+	if need > 0 && have < need {
+		filled = have * progressBarWidth / need
+	}
+	return "`" + strings.Repeat("▰", filled) + strings.Repeat("▱", progressBarWidth-filled) + "`"
+}
+
+func diffText(diff []pokemonsleep.FoodCount, locale string) string {
+	if len(diff) == 0 {
+		return pokemonsleep.Msg(locale, "前回から変化はありません")
+	}
+	changes := []string{}
+	for _, d := range diff {
+		if d.Num > 0 {
+			changes = append(changes, d.Name+" +"+strconv.Itoa(d.Num))
+		} else {
+			changes = append(changes, d.Name+" "+strconv.Itoa(d.Num))
+		}
+	}
+	return pokemonsleep.Msg(locale, "前回からの変化") + ": " + strings.Join(changes, pokemonsleep.Msg(locale, "、"))
+}
+
+func footerText(report *pokemonsleep.Report) string {
+	items := []string{pokemonsleep.Msg(report.Locale, "食材%d種類", len(report.Foods))}
+	if report.Pot > 0 {
+		items = append(items, pokemonsleep.Msg(report.Locale, "鍋%d", report.Pot))
+	}
+	if report.Level > 0 {
+		items = append(items, pokemonsleep.Msg(report.Locale, "レシピLv%d", report.Level))
+	}
+	return strings.Join(items, " ・ ")
+}
@@ -0,0 +1,49 @@
+package slackbot
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 受信済みのイベントIDを記録するストア
+// Slackからの再送（X-Slack-Retry-Num付き）を重複して処理しないために使う
+type SeenEventStore interface {
+	// eventIDを記録する。既に記録済みであればtrueを返す
+	MarkSeen(ctx context.Context, eventID string) (bool, error)
+}
+
+// プロセス内のメモリに記録するSeenEventStore
+// TTLを過ぎたイベントIDは次の記録時に破棄する
+// インスタンス間では共有されないので、複数のインスタンスで動かすと別のインスタンスに届いた再送は重複排除できない
+type MemorySeenEventStore struct {
+	TTL time.Duration
+
+	mu     sync.Mutex
+	events map[string]time.Time
+}
+
+func NewMemorySeenEventStore(ttl time.Duration) *MemorySeenEventStore {
+	return &MemorySeenEventStore{
+		TTL:    ttl,
+		events: make(map[string]time.Time),
+	}
+}
+
+func (m *MemorySeenEventStore) MarkSeen(ctx context.Context, eventID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, at := range m.events {
+		if now.Sub(at) > m.TTL {
+			delete(m.events, id)
+		}
+	}
+
+	if _, ok := m.events[eventID]; ok {
+		return true, nil
+	}
+	m.events[eventID] = now
+	return false, nil
+}
@@ -1,12 +1,18 @@
 package slackbot
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/SotaEndo0214/pbbotfunc/pkg/pokemonsleep"
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"go.uber.org/zap"
@@ -14,6 +20,11 @@ import (
 
 type CallbackFunc func(*SlackBot, context.Context, slackevents.EventsAPIEvent) error
 
+const (
+	DefaultWorkers      = 4
+	DefaultSeenEventTTL = 10 * time.Minute
+)
+
 type SlackBot struct {
 	Logger *zap.Logger
 
@@ -22,6 +33,16 @@ type SlackBot struct {
 	Api    *slack.Client
 
 	Callback CallbackFunc
+
+	// 再送イベントの重複排除に使うストア
+	Seen SeenEventStore
+	// 返信メッセージの組み立て方
+	Renderer Renderer
+	// スラッシュコマンドのサブコマンド
+	Commands *CommandRegistry
+
+	workers chan struct{}
+	wg      sync.WaitGroup
 }
 
 func NewSlackBot(logger *zap.Logger, token, secret string, callback CallbackFunc) *SlackBot {
@@ -31,6 +52,10 @@ func NewSlackBot(logger *zap.Logger, token, secret string, callback CallbackFunc
 		Secret:   secret,
 		Api:      slack.New(token),
 		Callback: callback,
+		Seen:     NewMemorySeenEventStore(DefaultSeenEventTTL),
+		Renderer: BlockRenderer{},
+		Commands: NewCommandRegistry(),
+		workers:  make(chan struct{}, DefaultWorkers),
 	}
 }
 
@@ -43,6 +68,11 @@ func (s *SlackBot) HandleRequest(ctx context.Context, w http.ResponseWriter, r *
 	defer r.Body.Close()
 	s.Logger.Info("request received")
 
+	// スラッシュコマンドはフォームで送られてくる
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/x-www-form-urlencoded" {
+		return s.HandleCommandRequest(ctx, w, r, body)
+	}
+
 	// eventをパース
 	event, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
 	if err != nil {
@@ -64,29 +94,159 @@ func (s *SlackBot) HandleRequest(ctx context.Context, w http.ResponseWriter, r *
 	}
 
 	// リクエストの検証
-	sv, err := slack.NewSecretsVerifier(r.Header, s.Secret)
+	if status, err := s.verify(r.Header, body); err != nil {
+		w.WriteHeader(status)
+		return err
+	}
+
+	// Eventのハンドリング
+	// Slackは3秒以内に応答がないと再送してくるので、処理はworkerに任せてすぐに応答する
+	// 応答後も処理を続けるので、Cloud Functionsでは常にCPUを割り当てて動かす（deploy.sh）
+	if event.Type == slackevents.CallbackEvent {
+		retryNum := r.Header.Get("X-Slack-Retry-Num")
+		accepted, err := s.Accept(ctx, event, retryNum != "")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return fmt.Errorf("accept event failed: %w", err)
+		}
+		if !accepted {
+			s.Logger.Info("drop retried event.", zap.String("retry_num", retryNum), zap.String("retry_reason", r.Header.Get("X-Slack-Retry-Reason")))
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// スラッシュコマンドのリクエストを検証してサブコマンドに振り分ける
+// イベントと同じく3秒以内に応答する必要があるので、すぐに空の応答を返し、結果はresponse_urlに送る
+func (s *SlackBot) HandleCommandRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, body []byte) error {
+	if status, err := s.verify(r.Header, body); err != nil {
+		w.WriteHeader(status)
+		return err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	cmd, err := slack.SlashCommandParse(r)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
-		return fmt.Errorf("create SecretsVerifier failed: %w", err)
+		return fmt.Errorf("parse slash command failed: %w", err)
+	}
+	s.Dispatch(ctx, cmd)
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// 署名（X-Slack-Signature）を検証する。失敗したら応答するステータスコードとエラーを返す
+func (s *SlackBot) verify(header http.Header, body []byte) (int, error) {
+	sv, err := slack.NewSecretsVerifier(header, s.Secret)
+	if err != nil {
+		return http.StatusBadRequest, fmt.Errorf("create SecretsVerifier failed: %w", err)
 	}
 	if _, err := sv.Write(body); err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return fmt.Errorf("write request to SecretsVerifier failed: %w", err)
+		return http.StatusInternalServerError, fmt.Errorf("write request to SecretsVerifier failed: %w", err)
 	}
 	if err := sv.Ensure(); err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return fmt.Errorf("ensure request failed: %w", err)
+		return http.StatusUnauthorized, fmt.Errorf("ensure request failed: %w", err)
 	}
+	return http.StatusOK, nil
+}
 
-	// Eventのハンドリング
-	if event.Type == slackevents.CallbackEvent {
-		err := s.Callback(s, ctx, event)
+// イベントをworkerに渡す。再送されたイベントが処理済みであれば何もせずfalseを返す
+func (s *SlackBot) Accept(ctx context.Context, event slackevents.EventsAPIEvent, retried bool) (bool, error) {
+	if data, ok := event.Data.(*slackevents.EventsAPICallbackEvent); ok && s.Seen != nil {
+		seen, err := s.Seen.MarkSeen(ctx, data.EventID)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			return fmt.Errorf("handle callback failed: %w", err)
+			return false, fmt.Errorf("mark seen event failed: %w", err)
+		}
+		if seen && retried {
+			return false, nil
+		}
+	}
+
+	s.run(ctx, func(ctx context.Context) error {
+		return s.Callback(s, ctx, event)
+	})
+	return true, nil
+}
+
+// fnをworkerで実行する
+func (s *SlackBot) run(ctx context.Context, fn func(context.Context) error) {
+	// リクエストのcontextは応答後にキャンセルされるので切り離す
+	ctx = context.WithoutCancel(ctx)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.workers <- struct{}{}
+		defer func() { <-s.workers }()
+
+		if err := fn(ctx); err != nil {
+			s.Logger.Error("handle callback failed.", zap.Error(err))
+			return
+		}
+		s.Logger.Info("handle finished.")
+	}()
+}
+
+// worker上で処理中のイベントがすべて終わるまで待つ
+func (s *SlackBot) Wait() {
+	s.wg.Wait()
+}
+
+// ユーザーのSlackのロケール（例: "en-US"）を返す
+// 取得できなければ空文字を返す（users:readのスコープが必要）
+func (s *SlackBot) UserLocale(ctx context.Context, user string) string {
+	if user == "" {
+		return ""
+	}
+	info, err := s.Api.GetUserInfoContext(ctx, user)
+	if err != nil {
+		s.Logger.Warn("get user info failed.", zap.String("user", user), zap.Error(err))
+		return ""
+	}
+	return info.Locale
+}
+
+// tsが空でなければそのメッセージのスレッドに投稿する
+func (s *SlackBot) PostText(channel, ts, text string) error {
+	return s.post(channel, ts, s.Renderer.Text(text))
+}
+
+// レシピの評価結果をRendererで組み立てて投稿する
+func (s *SlackBot) PostReport(channel, ts string, report *pokemonsleep.Report) error {
+	for _, options := range s.Renderer.Report(report) {
+		if err := s.post(channel, ts, options); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	s.Logger.Info("handle finished.")
+// ファイルをアップロードしてtsのスレッドに共有する
+func (s *SlackBot) UploadFile(channel, ts, filename string, data []byte, comment string) error {
+	_, err := s.Api.UploadFileV2(slack.UploadFileV2Parameters{
+		Reader:          bytes.NewReader(data),
+		FileSize:        len(data),
+		Filename:        filename,
+		Title:           filename,
+		InitialComment:  comment,
+		Channel:         channel,
+		ThreadTimestamp: ts,
+	})
+	if err != nil {
+		return fmt.Errorf("upload file failed: %w", err)
+	}
+	return nil
+}
+
+func (s *SlackBot) post(channel, ts string, options []slack.MsgOption) error {
+	if ts != "" {
+		options = append(options, slack.MsgOptionTS(ts))
+	}
+	_, _, err := s.Api.PostMessage(channel, options...)
+	if err != nil {
+		return fmt.Errorf("post message failed: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,151 @@
+package slackbot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/slack-go/slack/slackevents"
+	"go.uber.org/zap"
+)
+
+const (
+	testSecret = "test-signing-secret"
+
+	testEventBody = `{
+	"token": "token",
+	"team_id": "T1",
+	"api_app_id": "A1",
+	"type": "event_callback",
+	"event_id": "Ev1",
+	"event_time": 1700000000,
+	"event": {
+		"type": "app_mention",
+		"user": "U1",
+		"text": "<@B1> 在庫",
+		"channel": "C1",
+		"ts": "1700000000.000100",
+		"event_ts": "1700000000.000100"
+	}
+}`
+)
+
+// Slackと同じ方法で署名したリクエストを作る
+func newSignedRequest(t *testing.T, secret, contentType, body string) *http.Request {
+	t.Helper()
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+func handleEvent(t *testing.T, bot *SlackBot, retryNum string) int {
+	t.Helper()
+	req := newSignedRequest(t, testSecret, "application/json", testEventBody)
+	if retryNum != "" {
+		req.Header.Set("X-Slack-Retry-Num", retryNum)
+		req.Header.Set("X-Slack-Retry-Reason", "http_timeout")
+	}
+	w := httptest.NewRecorder()
+	if err := bot.HandleRequest(context.Background(), w, req); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code
+}
+
+// 処理が終わるのを待たずに200を返す
+func TestHandleRequestRespondsBeforeCallback(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished atomic.Bool
+	bot := NewSlackBot(zap.NewNop(), "xoxb-test", testSecret, func(s *SlackBot, ctx context.Context, event slackevents.EventsAPIEvent) error {
+		close(started)
+		<-release
+		finished.Store(true)
+		return nil
+	})
+
+	if code := handleEvent(t, bot, ""); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if finished.Load() {
+		t.Fatal("responded after the callback finished")
+	}
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback was not called")
+	}
+	close(release)
+	bot.Wait()
+	if !finished.Load() {
+		t.Error("callback did not finish")
+	}
+}
+
+// 初回の配信は1回だけ処理し、処理済みのイベントの再送は捨てる
+func TestHandleRequestDropsRetriedEvent(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		deliveries []string
+		want       int32
+	}{
+		{name: "first delivery", deliveries: []string{""}, want: 1},
+		{name: "retry of a seen event", deliveries: []string{"", "1", "2"}, want: 1},
+		// 初回の配信が届かず再送だけが届いた場合は処理する
+		{name: "retry of an unseen event", deliveries: []string{"1"}, want: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			bot := NewSlackBot(zap.NewNop(), "xoxb-test", testSecret, func(s *SlackBot, ctx context.Context, event slackevents.EventsAPIEvent) error {
+				calls.Add(1)
+				return nil
+			})
+			for _, retryNum := range tt.deliveries {
+				if code := handleEvent(t, bot, retryNum); code != http.StatusOK {
+					t.Fatalf("status = %d, want 200", code)
+				}
+			}
+			bot.Wait()
+			if got := calls.Load(); got != tt.want {
+				t.Errorf("callback called %d times, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// 署名が合わないイベントは処理しない
+func TestHandleRequestRejectsBadSignature(t *testing.T) {
+	var calls atomic.Int32
+	bot := NewSlackBot(zap.NewNop(), "xoxb-test", testSecret, func(s *SlackBot, ctx context.Context, event slackevents.EventsAPIEvent) error {
+		calls.Add(1)
+		return nil
+	})
+	req := newSignedRequest(t, "wrong-secret", "application/json", testEventBody)
+	w := httptest.NewRecorder()
+	if err := bot.HandleRequest(context.Background(), w, req); err == nil {
+		t.Error("HandleRequest succeeded with a bad signature")
+	}
+	bot.Wait()
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+	if calls.Load() != 0 {
+		t.Error("callback was called")
+	}
+}
@@ -0,0 +1,112 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"github.com/slack-go/slack/socketmode"
+	"go.uber.org/zap"
+)
+
+// Socket Modeで受信したEvents APIのイベントをSlackBot.Callbackに、スラッシュコマンドをSlackBot.Dispatchに渡すランナー
+// HTTPのエンドポイントを公開せずにbotを動かせる
+type SocketModeRunner struct {
+	Bot    *SlackBot
+	Client *socketmode.Client
+}
+
+// appTokenはconnections:writeスコープを持つApp-Level Token（xapp-）
+// optionsはwebsocketのスタブに向ける場合などにslack.OptionAPIURLを渡す
+func NewSocketModeRunner(bot *SlackBot, appToken string, options ...slack.Option) *SocketModeRunner {
+	options = append([]slack.Option{slack.OptionAppLevelToken(appToken)}, options...)
+	api := slack.New(bot.Token, options...)
+	return &SocketModeRunner{
+		Bot:    bot,
+		Client: socketmode.New(api),
+	}
+}
+
+func (r *SocketModeRunner) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- r.Client.RunContext(ctx)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errc:
+			if err != nil {
+				return fmt.Errorf("run socket mode failed: %w", err)
+			}
+			return nil
+		case evt := <-r.Client.Events:
+			r.handle(ctx, evt)
+		}
+	}
+}
+
+func (r *SocketModeRunner) handle(ctx context.Context, evt socketmode.Event) {
+	switch evt.Type {
+	case socketmode.EventTypeConnecting:
+		r.Bot.Logger.Info("connecting to slack with socket mode")
+	case socketmode.EventTypeConnected:
+		r.Bot.Logger.Info("connected to slack with socket mode")
+	case socketmode.EventTypeConnectionError:
+		r.Bot.Logger.Warn("socket mode connection failed. retrying")
+	case socketmode.EventTypeEventsAPI:
+		// 3秒以内にackしないとSlackから再送されるので、先にackしてから処理する
+		// 処理できない中身でもackしないと再送され続けるので、ackしてから捨てる
+		r.ack(evt.Request)
+		event, ok := evt.Data.(slackevents.EventsAPIEvent)
+		if !ok {
+			r.Bot.Logger.Warn("ignored unexpected events api payload", zap.Any("data", evt.Data))
+			return
+		}
+		r.Bot.Logger.Info("request received")
+
+		if event.Type == slackevents.CallbackEvent {
+			accepted, err := r.Bot.Accept(ctx, event, evt.Request.RetryAttempt > 0)
+			if err != nil {
+				r.Bot.Logger.Error("accept event failed.", zap.Error(err))
+				return
+			}
+			if !accepted {
+				r.Bot.Logger.Info("drop retried event.", zap.Int("retry_attempt", evt.Request.RetryAttempt), zap.String("retry_reason", evt.Request.RetryReason))
+			}
+		}
+	case socketmode.EventTypeSlashCommand:
+		r.ack(evt.Request)
+		cmd, ok := evt.Data.(slack.SlashCommand)
+		if !ok {
+			r.Bot.Logger.Warn("ignored unexpected slash command payload", zap.Any("data", evt.Data))
+			return
+		}
+		r.Bot.Dispatch(ctx, cmd)
+	case socketmode.EventTypeErrorBadMessage:
+		// 中身を読めなかったリクエストも、envelope_idが読めればackして再送を止める
+		bad, ok := evt.Data.(*socketmode.ErrorBadMessage)
+		if !ok {
+			return
+		}
+		var req socketmode.Request
+		if err := json.Unmarshal(bad.Message, &req); err == nil {
+			r.ack(&req)
+		}
+		r.Bot.Logger.Warn("dropped malformed socket mode message.", zap.Error(bad.Cause))
+	}
+}
+
+func (r *SocketModeRunner) ack(req *socketmode.Request) {
+	if req == nil || req.EnvelopeID == "" {
+		return
+	}
+	r.Client.Ack(*req)
+}
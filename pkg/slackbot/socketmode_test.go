@@ -0,0 +1,173 @@
+package slackbot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+	"go.uber.org/zap"
+)
+
+const (
+	testHello = `{"type":"hello","num_connections":1,"connection_info":{"app_id":"A1"}}`
+	// Events APIのイベントとして読めない中身
+	testMalformedEnvelope = `{"envelope_id": "env-bad", "type": "events_api", "retry_attempt": 0, "payload": "broken"}`
+	testEnvelope          = `{
+	"envelope_id": "env-1",
+	"type": "events_api",
+	"accepts_response_payload": false,
+	"retry_attempt": 0,
+	"payload": {
+		"token": "token",
+		"team_id": "T1",
+		"api_app_id": "A1",
+		"type": "event_callback",
+		"event_id": "Ev1",
+		"event_time": 1700000000,
+		"event": {
+			"type": "app_mention",
+			"user": "U1",
+			"text": "<@B1> 在庫",
+			"channel": "C1",
+			"ts": "1700000000.000100",
+			"event_ts": "1700000000.000100"
+		}
+	}
+}`
+)
+
+// Socket Modeのwebsocketのスタブ
+// 接続されるとhelloとenvelopesを順に送り、返ってきたackをacksに流す
+func newSocketModeServer(t *testing.T, acks chan<- string, envelopes ...string) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	// socketmodeのクライアントはOriginにslackのドメインを送ってくる
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":  true,
+			"url": "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws",
+		})
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(testHello)); err != nil {
+			return
+		}
+		for _, envelope := range envelopes {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(envelope)); err != nil {
+				return
+			}
+		}
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var ack struct {
+				EnvelopeID string `json:"envelope_id"`
+			}
+			if err := json.Unmarshal(data, &ack); err == nil && ack.EnvelopeID != "" {
+				acks <- ack.EnvelopeID
+			}
+		}
+	})
+	srv = httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// Socket Modeで受信したイベントがackされ、Callbackに渡る
+func TestSocketModeRunner(t *testing.T) {
+	acks := make(chan string, 1)
+	events := make(chan slackevents.EventsAPIEvent, 1)
+	srv := newSocketModeServer(t, acks, testEnvelope)
+
+	bot := NewSlackBot(zap.NewNop(), "xoxb-test", "", func(s *SlackBot, ctx context.Context, event slackevents.EventsAPIEvent) error {
+		events <- event
+		return nil
+	})
+	runner := NewSocketModeRunner(bot, "xapp-test", slack.OptionAPIURL(srv.URL+"/"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go runner.Run(ctx)
+
+	select {
+	case id := <-acks:
+		if id != "env-1" {
+			t.Errorf("acked %q, want env-1", id)
+		}
+	case <-ctx.Done():
+		t.Fatal("event was not acked")
+	}
+
+	select {
+	case event := <-events:
+		mention, ok := event.InnerEvent.Data.(*slackevents.AppMentionEvent)
+		if !ok {
+			t.Fatalf("inner event = %T, want *slackevents.AppMentionEvent", event.InnerEvent.Data)
+		}
+		if mention.Text != "<@B1> 在庫" {
+			t.Errorf("text = %q", mention.Text)
+		}
+	case <-ctx.Done():
+		t.Fatal("callback was not called")
+	}
+	bot.Wait()
+}
+
+// 読めない中身のイベントもackし、Callbackには渡さない
+func TestSocketModeRunnerAcksMalformedPayload(t *testing.T) {
+	acks := make(chan string, 2)
+	events := make(chan slackevents.EventsAPIEvent, 2)
+	srv := newSocketModeServer(t, acks, testMalformedEnvelope, testEnvelope)
+
+	bot := NewSlackBot(zap.NewNop(), "xoxb-test", "", func(s *SlackBot, ctx context.Context, event slackevents.EventsAPIEvent) error {
+		events <- event
+		return nil
+	})
+	runner := NewSocketModeRunner(bot, "xapp-test", slack.OptionAPIURL(srv.URL+"/"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go runner.Run(ctx)
+
+	acked := []string{}
+	for len(acked) < 2 {
+		select {
+		case id := <-acks:
+			acked = append(acked, id)
+		case <-ctx.Done():
+			t.Fatalf("acked %v, want env-bad and env-1", acked)
+		}
+	}
+	if acked[0] != "env-bad" || acked[1] != "env-1" {
+		t.Errorf("acked %v, want [env-bad env-1]", acked)
+	}
+
+	// 後から送った正しいイベントだけがCallbackに渡る
+	select {
+	case <-events:
+	case <-ctx.Done():
+		t.Fatal("callback was not called")
+	}
+	bot.Wait()
+	if len(events) != 0 {
+		t.Errorf("callback called %d more times, want once", len(events))
+	}
+}
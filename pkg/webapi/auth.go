@@ -0,0 +1,48 @@
+package webapi
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// APIキーを確認してから次のハンドラに渡すミドルウェア
+// キーは"Authorization: Bearer <key>"か"X-API-Key: <key>"で受け取る。keysが空ならすべて拒否する
+func RequireAPIKey(logger *zap.Logger, keys []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if key == "" || !validKey(keys, key) {
+			logger.Info("reject api request.", zap.String("path", r.URL.Path), zap.Bool("has_key", key != ""))
+			writeError(w, http.StatusUnauthorized, "invalid api key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// 比較にかかる時間からキーを推測されないよう、定数時間で比較する
+func validKey(keys []string, key string) bool {
+	ok := false
+	for _, k := range keys {
+		if k != "" && subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// カンマ区切りのAPIキーを分割する（空の要素は除く）
+func ParseAPIKeys(s string) []string {
+	keys := []string{}
+	for _, key := range strings.Split(s, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
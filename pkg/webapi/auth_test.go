@@ -0,0 +1,61 @@
+package webapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		keys   []string
+		header map[string]string
+		want   int
+	}{
+		{name: "missing key", keys: []string{"key-1"}, want: http.StatusUnauthorized},
+		{name: "wrong X-API-Key", keys: []string{"key-1"}, header: map[string]string{"X-API-Key": "key-2"}, want: http.StatusUnauthorized},
+		{name: "wrong bearer", keys: []string{"key-1"}, header: map[string]string{"Authorization": "Bearer key-2"}, want: http.StatusUnauthorized},
+		{name: "not bearer", keys: []string{"key-1"}, header: map[string]string{"Authorization": "Basic key-1"}, want: http.StatusUnauthorized},
+		{name: "no keys configured", keys: []string{}, header: map[string]string{"X-API-Key": "key-1"}, want: http.StatusUnauthorized},
+		{name: "X-API-Key", keys: []string{"key-1", "key-2"}, header: map[string]string{"X-API-Key": "key-2"}, want: http.StatusOK},
+		{name: "bearer", keys: []string{"key-1", "key-2"}, header: map[string]string{"Authorization": "Bearer key-1"}, want: http.StatusOK},
+		// Authorizationがあればそちらを使う
+		{name: "bearer wins", keys: []string{"key-1"}, header: map[string]string{"Authorization": "Bearer key-2", "X-API-Key": "key-1"}, want: http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			handler := RequireAPIKey(zap.NewNop(), tt.keys, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "/analyze", nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if called != (tt.want == http.StatusOK) {
+				t.Errorf("next handler called = %v", called)
+			}
+		})
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	got := ParseAPIKeys(" key-1, ,key-2,")
+	want := []string{"key-1", "key-2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAPIKeys = %v, want %v", got, want)
+	}
+	if got := ParseAPIKeys(""); len(got) != 0 {
+		t.Errorf("ParseAPIKeys(\"\") = %v, want empty", got)
+	}
+}
@@ -0,0 +1,157 @@
+package webapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/SotaEndo0214/pbbotfunc/pkg/pokemonsleep"
+	"go.uber.org/zap"
+)
+
+const (
+	// リクエストボディの上限（スクリーンショット数枚分）
+	MaxRequestBytes = 32 << 20
+	// 1リクエストで受け付ける画像の枚数
+	MaxImages = 10
+)
+
+// Slackを介さずに食材の検出とレシピの評価を行うJSON API
+//
+//	POST /analyze
+//	  multipart/form-data: image（複数可）, text
+//	  application/json:    {"images": ["<base64>", ...], "text": "..."}
+//
+// textはメンション本文と同じく、カテゴリ・鍋の容量・レシピレベル・言語（lang=en）の指定に使う
+// 言語の指定がなければAccept-Languageの言語で名前と文言を返す
+type Server struct {
+	Logger *zap.Logger
+	Client *pokemonsleep.Client
+
+	mux *http.ServeMux
+}
+
+// APIキーの確認を挟んだServerを返す
+func NewServer(logger *zap.Logger, client *pokemonsleep.Client, keys []string) http.Handler {
+	s := &Server{
+		Logger: logger,
+		Client: client,
+		mux:    http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/analyze", s.HandleAnalyze)
+	return RequireAPIKey(logger, keys, s)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// base64で画像を送るときのリクエスト
+type AnalyzeRequest struct {
+	Images []string `json:"images"`
+	Text   string   `json:"text"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) HandleAnalyze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBytes)
+
+	text, images, err := s.readAnalyzeRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(images) == 0 {
+		writeError(w, http.StatusBadRequest, "no image")
+		return
+	}
+	if len(images) > MaxImages {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("too many images (max %d)", MaxImages))
+		return
+	}
+
+	imgs := []*pokemonsleep.Image{}
+	for i, data := range images {
+		img, err := pokemonsleep.DecodeImage(data, s.Logger)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("image %d: %v", i, err))
+			return
+		}
+		imgs = append(imgs, img)
+	}
+
+	// Slackユーザーの在庫と混ざらないよう、APIからの検出結果は保存しない
+	locale := pokemonsleep.ResolveLocale(text, r.Header.Get("Accept-Language"))
+	report, err := s.Client.GetResultFromImages(r.Context(), "", text, locale, imgs...)
+	if err != nil {
+		s.Logger.Error("analyze failed.", zap.Error(err))
+		writeError(w, http.StatusInternalServerError, "analyze failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) readAnalyzeRequest(r *http.Request) (string, [][]byte, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return "", nil, fmt.Errorf("parse content type failed: %w", err)
+	}
+
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(MaxRequestBytes); err != nil {
+			return "", nil, fmt.Errorf("parse multipart form failed: %w", err)
+		}
+		images := [][]byte{}
+		for _, header := range r.MultipartForm.File["image"] {
+			file, err := header.Open()
+			if err != nil {
+				return "", nil, fmt.Errorf("open %s failed: %w", header.Filename, err)
+			}
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				return "", nil, fmt.Errorf("read %s failed: %w", header.Filename, err)
+			}
+			images = append(images, data)
+		}
+		return r.FormValue("text"), images, nil
+	case "application/json":
+		var req AnalyzeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return "", nil, fmt.Errorf("json decode failed: %w", err)
+		}
+		images := [][]byte{}
+		for i, encoded := range req.Images {
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return "", nil, fmt.Errorf("image %d: base64 decode failed: %w", i, err)
+			}
+			images = append(images, data)
+		}
+		return req.Text, images, nil
+	}
+	return "", nil, errors.New("unsupported content type: " + mediaType)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
@@ -0,0 +1,226 @@
+package webapi
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SotaEndo0214/pbbotfunc/pkg/pokemonsleep"
+	"go.uber.org/zap"
+)
+
+const testAPIKey = "test-key"
+
+// 記録済みのOCR結果を返すReplayDetectorと、それに対応する画像を用意する
+// 画像は全体をゲーム画面とみなされるよう、左上と右下の角だけ色を変える
+func newTestServer(t *testing.T) (http.Handler, []byte) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 1080, 2340))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	img.SetGray(0, 0, color.Gray{})
+	img.SetGray(1079, 2339, color.Gray{})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	annotations, err := os.ReadFile("../../data/fixtures/synthetic/bag_all_foods.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, pokemonsleep.AnnotationFileName(buf.Bytes())), annotations, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := pokemonsleep.NewClientWithDetector("", pokemonsleep.NewReplayDetector(dir), "../../data/foods.json", "../../data/cooks.json", zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return NewServer(zap.NewNop(), client, []string{testAPIKey}), buf.Bytes()
+}
+
+func multipartBody(t *testing.T, text string, images ...[]byte) (string, io.Reader) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	if err := mw.WriteField("text", text); err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range images {
+		fw, err := mw.CreateFormFile("image", fmt.Sprintf("bag%d.png", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return mw.FormDataContentType(), &buf
+}
+
+func jsonBody(t *testing.T, req AnalyzeRequest) (string, io.Reader) {
+	t.Helper()
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "application/json", bytes.NewReader(data)
+}
+
+func TestHandleAnalyze(t *testing.T) {
+	server, png := newTestServer(t)
+	encoded := base64.StdEncoding.EncodeToString(png)
+
+	for _, tt := range []struct {
+		name      string
+		method    string
+		body      func(t *testing.T) (string, io.Reader)
+		want      int
+		wantError string
+	}{
+		{
+			name: "multipart",
+			body: func(t *testing.T) (string, io.Reader) { return multipartBody(t, "カレー", png) },
+			want: http.StatusOK,
+		},
+		{
+			name: "base64",
+			body: func(t *testing.T) (string, io.Reader) {
+				return jsonBody(t, AnalyzeRequest{Images: []string{encoded}, Text: "カレー"})
+			},
+			want: http.StatusOK,
+		},
+		{
+			name: "malformed base64",
+			body: func(t *testing.T) (string, io.Reader) {
+				return jsonBody(t, AnalyzeRequest{Images: []string{encoded, "not base64!"}})
+			},
+			want:      http.StatusBadRequest,
+			wantError: "image 1: base64 decode failed",
+		},
+		{
+			name: "malformed json",
+			body: func(t *testing.T) (string, io.Reader) {
+				return "application/json", strings.NewReader(`{"images": [`)
+			},
+			want:      http.StatusBadRequest,
+			wantError: "json decode failed",
+		},
+		{
+			name:      "not an image",
+			body:      func(t *testing.T) (string, io.Reader) { return multipartBody(t, "", []byte("hello")) },
+			want:      http.StatusBadRequest,
+			wantError: "image 0: decode image config failed",
+		},
+		{
+			name:      "no image",
+			body:      func(t *testing.T) (string, io.Reader) { return multipartBody(t, "カレー") },
+			want:      http.StatusBadRequest,
+			wantError: "no image",
+		},
+		{
+			name: "too many images",
+			body: func(t *testing.T) (string, io.Reader) {
+				images := []string{}
+				for i := 0; i <= MaxImages; i++ {
+					images = append(images, encoded)
+				}
+				return jsonBody(t, AnalyzeRequest{Images: images})
+			},
+			want:      http.StatusBadRequest,
+			wantError: "too many images",
+		},
+		{
+			name: "unsupported content type",
+			body: func(t *testing.T) (string, io.Reader) {
+				return "text/plain", strings.NewReader(encoded)
+			},
+			want:      http.StatusBadRequest,
+			wantError: "unsupported content type: text/plain",
+		},
+		{
+			name:      "get",
+			method:    http.MethodGet,
+			body:      func(t *testing.T) (string, io.Reader) { return "", nil },
+			want:      http.StatusMethodNotAllowed,
+			wantError: "method not allowed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			contentType, body := tt.body(t)
+			req := httptest.NewRequest(method, "/analyze", body)
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			req.Header.Set("Authorization", "Bearer "+testAPIKey)
+			w := httptest.NewRecorder()
+			server.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.want, w.Body.String())
+			}
+			if tt.want != http.StatusOK {
+				var res errorResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+					t.Fatalf("unmarshal error response (%s) failed: %v", w.Body.String(), err)
+				}
+				if !strings.Contains(res.Error, tt.wantError) {
+					t.Errorf("error = %q, want to contain %q", res.Error, tt.wantError)
+				}
+				return
+			}
+
+			var report pokemonsleep.Report
+			if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+				t.Fatalf("unmarshal report failed: %v", err)
+			}
+			got := map[string]int{}
+			for _, food := range report.Foods {
+				got[food.Name] = food.Num
+			}
+			// bag_all_foodsの期待値から抜き出したもの
+			for name, want := range map[string]int{"とくせんリンゴ": 42, "マメミート": 33, "おいしいシッポ": 3} {
+				if got[name] != want {
+					t.Errorf("%s: got x%d, want x%d", name, got[name], want)
+				}
+			}
+			if len(got) != 16 {
+				t.Errorf("got %d foods, want 16: %v", len(got), got)
+			}
+		})
+	}
+}
+
+// APIキーがなければ画像を読む前に断る
+func TestHandleAnalyzeRequiresAPIKey(t *testing.T) {
+	server, png := newTestServer(t)
+	contentType, body := multipartBody(t, "", png)
+	req := httptest.NewRequest(http.MethodPost, "/analyze", body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", w.Code)
+	}
+}